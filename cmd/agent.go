@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Agent implements the "agent" cli command
+func Agent(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> [--id=<NODE-ID>] [--interval=<time_in_secs>] [--max-backoff=<time_in_secs>] [--leave-on-shutdown] [--rotate-interval=<time_in_secs>] [--rotate-grace=<time_in_secs>]"
+	var (
+		meshName        = cmd.StringOpt("name", "", "Name of the mesh to keep updated")
+		nodeID          = cmd.StringOpt("id", "", "Identifier of this node. Must be unique across the mesh. Optional, defaults to MD5 of hostname")
+		intervalSecs    = cmd.IntOpt("interval i", 30, "Number of seconds between updates")
+		maxBackoffSecs  = cmd.IntOpt("max-backoff", 300, "Maximum number of seconds to wait between retries when vault is not reachable")
+		leaveOnShutdown = cmd.BoolOpt("leave-on-shutdown", false, "Leave the mesh when receiving SIGTERM or SIGINT")
+		rotateSecs      = cmd.IntOpt("rotate-interval", 0, "Number of seconds after which the wireguard key is rotated. Default: 0=never")
+		rotateGraceSecs = cmd.IntOpt("rotate-grace", 0, "Number of seconds peers have to install a new key before the rotation is cancelled. Default: 0=600, but at least three intervals")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+		if *nodeID == "" {
+			*nodeID = config.UniqueID()
+			log.WithField("ID", *nodeID).Info("Using node id")
+		}
+		log.WithField("id", *nodeID).Trace("Param")
+		if *intervalSecs <= 0 {
+			log.Errorf("--interval must be greater than 0.")
+			os.Exit(exitInvalidParam)
+		}
+		if *rotateSecs < 0 {
+			log.Errorf("--rotate-interval must not be negative.")
+			os.Exit(exitInvalidParam)
+		}
+		if *rotateGraceSecs < 0 {
+			log.Errorf("--rotate-grace must not be negative.")
+			os.Exit(exitInvalidParam)
+		}
+		if *maxBackoffSecs < *intervalSecs {
+			*maxBackoffSecs = *intervalSecs
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+		mc := meshContext()
+
+		err := mc.Agent(&mesh.AgentRequest{
+			MeshName:         *meshName,
+			NodeID:           *nodeID,
+			Interval:         time.Duration(*intervalSecs) * time.Second,
+			MaxBackoff:       time.Duration(*maxBackoffSecs) * time.Second,
+			LeaveOnShutdown:  *leaveOnShutdown,
+			KeyRotation:      time.Duration(*rotateSecs) * time.Second,
+			KeyRotationGrace: time.Duration(*rotateGraceSecs) * time.Second,
+			Signals:          signals,
+		})
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to run agent for mesh: %s", err)
+			os.Exit(exitUnableToRunAgent)
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 
+	"github.com/aschmidt75/wireguard-vault-automesh/ipam"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
 	"github.com/aschmidt75/wireguard-vault-automesh/vault"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
@@ -12,10 +15,16 @@ import (
 
 // Create implements the "create" cli command
 func Create(cmd *cli.Cmd) {
-	cmd.Spec = "--name=<MESH-NAME> [--cidr=<CIDR>]"
+	cmd.Spec = "--name=<MESH-NAME> [--cidr=<CIDR>] [--reserve=<RANGE>...] [--ttl=<time_in_secs>] [--namespace=<NAMESPACE>] [--encrypt] [--psk [--psk-rotation=<time_in_secs>]]"
 	var (
-		meshName    = cmd.StringOpt("name", "", "Name of the new mesh.")
-		networkCidr = cmd.StringOpt("cidr", "10.37.0.0/16", "IP range of the new mesh network in CIDR format")
+		meshName       = cmd.StringOpt("name", "", "Name of the new mesh.")
+		networkCidr    = cmd.StringOpt("cidr", "10.37.0.0/16", "IP range of the new mesh network in CIDR format. IPv4 or IPv6, or one of each separated by comma for a dual-stack mesh")
+		reservedRanges = cmd.StringsOpt("reserve", []string{}, "IP range within the mesh network that is never assigned to nodes. Single IP, CIDR or <first IP>-<last IP>. May be repeated.")
+		nodeTTL        = cmd.IntOpt("ttl", 0, "Number of seconds after which nodes without a heartbeat are considered gone. Default: 0=nodes never expire")
+		namespace      = cmd.StringOpt("namespace", "", "Vault namespace to keep the mesh in. Other commands need the same namespace via WGVAM_VAULT_MESH_NAMESPACES. Vault backend only.")
+		encrypt        = cmd.BoolOpt("encrypt", false, "Encrypt node records using a vault transit key of this mesh. Vault backend only.")
+		psk            = cmd.BoolOpt("psk", false, "Use a preshared key for each pair of nodes. Vault backend only.")
+		pskRotation    = cmd.IntOpt("psk-rotation", 0, "Number of seconds after which preshared keys are replaced. Default: 0=never")
 	)
 
 	cmd.Action = func() {
@@ -29,17 +38,101 @@ func Create(cmd *cli.Cmd) {
 			log.Errorf("Must supply an IP network range using --cidr.")
 			os.Exit(exitMissingOrInvalidCIDR)
 		}
-		_, _, err := net.ParseCIDR(*networkCidr)
-		if err != nil {
-			log.WithError(err).Trace("Unable to parse --cidr")
-			log.Errorf("Must supply a valid IP network range using --cidr.")
-			os.Exit(exitMissingOrInvalidCIDR)
+		var networkCidr4, networkCidr6 string
+		for _, cidr := range strings.Split(*networkCidr, ",") {
+			ip, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				log.WithError(err).Trace("Unable to parse --cidr")
+				log.Errorf("Must supply a valid IP network range using --cidr.")
+				os.Exit(exitMissingOrInvalidCIDR)
+			}
+			if ip.To4() != nil {
+				if networkCidr4 != "" {
+					log.Errorf("Must supply at most one IPv4 network range using --cidr.")
+					os.Exit(exitMissingOrInvalidCIDR)
+				}
+				networkCidr4 = ipnet.String()
+			} else {
+				if networkCidr6 != "" {
+					log.Errorf("Must supply at most one IPv6 network range using --cidr.")
+					os.Exit(exitMissingOrInvalidCIDR)
+				}
+				networkCidr6 = ipnet.String()
+			}
+		}
+		req := &mesh.CreateRequest{
+			MeshName:       *meshName,
+			NetworkCIDR:    networkCidr4,
+			NetworkCIDR6:   networkCidr6,
+			ReservedRanges: *reservedRanges,
+			NodeTTL:        *nodeTTL,
+			Namespace:      *namespace,
+		}
+		if *encrypt {
+			req.TransitKey = vault.TransitKeyName(*meshName)
+		}
+		if *psk {
+			req.PresharedKeys = true
+			req.PSKRotation = *pskRotation
+		}
+		if networkCidr4 == "" {
+			// ipv6-only
+			req.NetworkCIDR, req.NetworkCIDR6 = networkCidr6, ""
+		}
+		log.WithFields(log.Fields{
+			"cidr":  req.NetworkCIDR,
+			"cidr6": req.NetworkCIDR6,
+		}).Trace("Param")
+		if *namespace != "" {
+			log.WithField("namespace", *namespace).Trace("Param")
+			if !IsVaultBackend() {
+				log.Errorf("--namespace is only supported by the vault backend.")
+				os.Exit(exitInvalidParam)
+			}
+		}
+		if *encrypt {
+			log.WithField("encrypt", req.TransitKey).Trace("Param")
+			if !IsVaultBackend() {
+				log.Errorf("--encrypt is only supported by the vault backend.")
+				os.Exit(exitInvalidParam)
+			}
+		}
+		if *psk {
+			log.WithField("psk-rotation", req.PSKRotation).Trace("Param")
+			if !IsVaultBackend() {
+				log.Errorf("--psk is only supported by the vault backend.")
+				os.Exit(exitInvalidParam)
+			}
+			if req.PSKRotation < 0 {
+				log.Errorf("--psk-rotation must not be negative.")
+				os.Exit(exitInvalidParam)
+			}
+		}
+
+		for _, cidr := range []string{req.NetworkCIDR, req.NetworkCIDR6} {
+			if cidr == "" {
+				continue
+			}
+			pool, err := ipam.NewPool(cidr, *reservedRanges)
+			if err != nil {
+				log.WithError(err).Trace("Unable to parse --reserve")
+				log.Errorf("Must supply valid IP ranges using --reserve.")
+				os.Exit(exitInvalidParam)
+			}
+			if pool.Size().Sign() <= 0 {
+				log.Errorf("No usable IP addresses left in %s after excluding network, broadcast and --reserve ranges.", cidr)
+				os.Exit(exitMissingOrInvalidCIDR)
+			}
+			log.WithFields(log.Fields{
+				"cidr":     cidr,
+				"reserved": *reservedRanges,
+				"usable":   pool.Size(),
+			}).Trace("Param")
 		}
-		log.WithField("cidr", *networkCidr).Trace("Param")
 
-		vc := vault.Vault()
+		mc := meshContext()
 
-		bCreated, err := vc.Create(*meshName, *networkCidr)
+		bCreated, err := mc.Create(req)
 		if err != nil {
 			log.WithError(err).Errorf("Unable to create network: %s", *meshName)
 		}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/aschmidt75/wireguard-vault-automesh/vault"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,9 +22,9 @@ func Delete(cmd *cli.Cmd) {
 		}
 		log.WithField("name", *meshName).Trace("Param")
 
-		vc := vault.Vault()
+		mc := meshContext()
 
-		bDeleted, err := vc.Delete(*meshName)
+		bDeleted, err := mc.Delete(*meshName)
 		if err != nil {
 			log.WithError(err).Errorf("Unable to delete network: %s", *meshName)
 			os.Exit(exitUnableToDelete)
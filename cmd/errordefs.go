@@ -1,13 +1,23 @@
 package cmd
 
 const (
-	exitOk                   = 0
-	exitMissingParams        = 10
-	exitMissingOrInvalidCIDR = 11
-	exitInvalidParam         = 12
-	exitUnableToCreate       = 20
-	exitUnableToJoin         = 21
-	exitUnableToUpdate       = 22
-	exitUnableToLeave        = 23
-	exitUnableToDelete       = 24
+	exitOk                     = 0
+	exitMissingParams          = 10
+	exitMissingOrInvalidCIDR   = 11
+	exitInvalidParam           = 12
+	exitUnableToCreate         = 20
+	exitUnableToJoin           = 21
+	exitUnableToUpdate         = 22
+	exitUnableToLeave          = 23
+	exitUnableToDelete         = 24
+	exitMeshFull               = 25
+	exitUnableToRunAgent       = 26
+	exitUnableToPrune          = 27
+	exitUnableToQueryStatus    = 28
+	exitUnableToList           = 29
+	exitUnableToAccessRegistry = 30
+	exitUnableToInvite         = 31
+	exitUnableToWritePolicy    = 32
+	exitUnableToRotateKey      = 33
+	exitKeyConflict            = 34
 )
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Invite implements the "invite" cli command
+func Invite(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> --id=<NODE-ID> [--ttl=<DURATION>] [--token-ttl=<DURATION>]"
+	var (
+		meshName = cmd.StringOpt("name", "", "Name of the mesh to invite a node to")
+		nodeID   = cmd.StringOpt("id", "", "Identifier of the invited node. The invite is only valid for this node id")
+		wrapTTL  = cmd.StringOpt("ttl", "10m", "Duration within which the invite must be used")
+		tokenTTL = cmd.StringOpt("token-ttl", "1h", "Duration for which the token within the invite is valid after joining")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+		if *nodeID == "" {
+			log.Errorf("Must set the id of the invited node using --id.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("id", *nodeID).Trace("Param")
+		wrapDuration, err := time.ParseDuration(*wrapTTL)
+		if err != nil || wrapDuration <= 0 {
+			log.Errorf("Must supply a valid duration using --ttl, e.g. 10m.")
+			os.Exit(exitInvalidParam)
+		}
+		log.WithField("ttl", wrapDuration).Trace("Param")
+		tokenDuration, err := time.ParseDuration(*tokenTTL)
+		if err != nil || tokenDuration <= 0 {
+			log.Errorf("Must supply a valid duration using --token-ttl, e.g. 1h.")
+			os.Exit(exitInvalidParam)
+		}
+		log.WithField("token-ttl", tokenDuration).Trace("Param")
+
+		vc, ok := newRegistry().(*vault.Context)
+		if !ok {
+			log.Errorf("Invites are only supported by the vault backend.")
+			os.Exit(exitInvalidParam)
+		}
+
+		meshInfo, err := vc.ReadMeetingPoint(*meshName)
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to read mesh network: %s", err)
+		}
+		if meshInfo == nil {
+			os.Exit(exitUnableToInvite)
+		}
+
+		token, err := vc.CreateInvite(*meshName, *nodeID, wrapDuration, tokenDuration)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to create invite for mesh: %s", *meshName)
+			os.Exit(exitUnableToInvite)
+		}
+
+		fmt.Println(token)
+	}
+}
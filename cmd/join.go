@@ -1,27 +1,37 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"strings"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/ipam"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
 	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
 )
 
 // Join implements the "join" cli command
 func Join(cmd *cli.Cmd) {
-	cmd.Spec = "--name=<MESH-NAME> [--id=<NODE-ID>] --endpoint=<IP>"
+	cmd.Spec = "[--name=<MESH-NAME>] [--id=<NODE-ID>] --endpoint=<IP> [--invite=<WRAPPED-TOKEN>] [--wg-impl=<IMPL>] [--force]"
 	var (
 		meshName   = cmd.StringOpt("name", "", "Name of the mesh to join")
 		nodeID     = cmd.StringOpt("id", "", "Identifier of this node. Must be unique across the mesh. Optional, defaults to MD5 of hostname")
 		endpointIP = cmd.StringOpt("endpoint e", "", "Network interface name of IP of this node where wireguard traffic goes out to other nodes, e.g. eth0.")
+		wgImpl     = cmd.StringOpt("wg-impl", wg.ImplKernel, "Wireguard implementation: kernel, userspace (wireguard-go) or auto (kernel, falling back to userspace)")
+		invite     = cmd.StringOpt("invite", "", "Invite created by the invite command. Mesh name and node id are taken from the invite. Vault backend only.")
+		force      = cmd.BoolOpt("force", false, "Replace the registered public key of this node if it does not match the local one")
 	)
 
 	cmd.Action = func() {
+		if *invite != "" {
+			redeemInvite(*invite, meshName, nodeID)
+		}
 		if *meshName == "" {
 			log.Errorf("Must set a name for the mesh using --name.")
 			os.Exit(exitMissingParams)
@@ -49,19 +59,33 @@ func Join(cmd *cli.Cmd) {
 				log.Errorf("--endpoint is a valid interface name, but unable to get IP of it")
 				os.Exit(exitInvalidParam)
 			}
-			addrParts := strings.Split(addrs[0].String(), "/")
-			if len(addrParts) > 0 {
-				*endpointIP = addrParts[0]
-			} else {
-				log.Errorf("internal error parsing ip address of --endpoint interface")
+			*endpointIP = ""
+			for _, addr := range addrs {
+				// skip link-local addresses, they're not reachable from other nodes
+				ipnet, ok := addr.(*net.IPNet)
+				if !ok || ipnet.IP.IsLinkLocalUnicast() {
+					continue
+				}
+				*endpointIP = ipnet.IP.String()
+				break
+			}
+			if *endpointIP == "" {
+				log.Errorf("--endpoint is a valid interface name, but it has no usable IP address")
 				os.Exit(exitInvalidParam)
 			}
 		}
 		log.WithField("endpoint", *endpointIP).Trace("Param")
+		switch *wgImpl {
+		case wg.ImplKernel, wg.ImplUserspace, wg.ImplAuto:
+		default:
+			log.Errorf("Must set --wg-impl to one of kernel, userspace or auto.")
+			os.Exit(exitInvalidParam)
+		}
+		log.WithField("wg-impl", *wgImpl).Trace("Param")
 
-		vc := vault.Vault()
+		mc := meshContext()
 
-		meshInfo, err := vc.ReadMeetingPoint(*meshName)
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
 		if err != nil {
 			log.WithError(err).Trace("internal error")
 			log.Errorf("Unable to join network: %s", err)
@@ -70,13 +94,34 @@ func Join(cmd *cli.Cmd) {
 			os.Exit(exitUnableToJoin)
 		}
 
-		err = vc.Join(&vault.JoinRequest{
-			MeshName:   *meshName,
-			MeshInfo:   meshInfo,
-			NodeID:     *nodeID,
-			EndpointIP: *endpointIP,
-			ListenPort: config.Config().DefaultEndpointListenPort,
+		err = mc.Join(&mesh.JoinRequest{
+			MeshName:      *meshName,
+			MeshInfo:      meshInfo,
+			NodeID:        *nodeID,
+			EndpointIP:    *endpointIP,
+			ListenPort:    config.Config().DefaultEndpointListenPort,
+			WireguardImpl: *wgImpl,
+			Force:         *force,
 		})
+		if errors.Is(err, wg.ErrNoKernelModule) {
+			log.WithError(err).Errorf("Unable to join mesh: %s. Try --wg-impl=auto or --wg-impl=userspace.", *meshName)
+			os.Exit(exitUnableToJoin)
+		}
+		if err == mesh.ErrKeyMismatch {
+			log.WithError(err).Errorf("Unable to join mesh: %s. Use --force to replace the registered key.", *meshName)
+			os.Exit(exitUnableToJoin)
+		}
+		if conflictErr, ok := err.(*mesh.ConflictError); ok {
+			log.WithError(err).Errorf("Unable to join mesh: %s", *meshName)
+			for pubkey, nodeIDs := range conflictErr.Conflicts {
+				fmt.Printf("Public key %s is used by nodes: %s\n", pubkey, strings.Join(nodeIDs, ", "))
+			}
+			os.Exit(exitKeyConflict)
+		}
+		if err == ipam.ErrMeshFull {
+			log.WithError(err).Errorf("Unable to join mesh: %s", *meshName)
+			os.Exit(exitMeshFull)
+		}
 		if err != nil {
 			log.WithError(err).Errorf("Unable to join mesh: %s", *meshName)
 			os.Exit(exitUnableToJoin)
@@ -84,3 +129,31 @@ func Join(cmd *cli.Cmd) {
 		fmt.Printf("Joined mesh network '%s'.\n", *meshName)
 	}
 }
+
+// redeemInvite unwraps the invite and uses its token for all further vault
+// requests. Mesh name and node id must match the invite if given.
+func redeemInvite(wrappingToken string, meshName, nodeID *string) {
+	c := config.Config()
+	if !IsVaultBackend() {
+		log.Errorf("--invite is only supported by the vault backend.")
+		os.Exit(exitInvalidParam)
+	}
+
+	inv, err := vault.RedeemInvite(wrappingToken, *meshName)
+	if err != nil {
+		log.WithError(err).Error("Unable to redeem invite. It may have expired or been used before.")
+		os.Exit(exitUnableToJoin)
+	}
+	if (*meshName != "" && *meshName != inv.MeshName) || (*nodeID != "" && *nodeID != inv.NodeID) {
+		log.Errorf("Invite is for node '%s' of mesh '%s'.", inv.NodeID, inv.MeshName)
+		os.Exit(exitInvalidParam)
+	}
+	*meshName, *nodeID = inv.MeshName, inv.NodeID
+	log.WithFields(log.Fields{
+		"name": inv.MeshName,
+		"id":   inv.NodeID,
+	}).Debug("Redeemed invite")
+
+	c.VaultAuth = "token"
+	c.VaultToken = inv.Token
+}
@@ -5,7 +5,7 @@ import (
 	"os"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/config"
-	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
 )
@@ -29,9 +29,9 @@ func Leave(cmd *cli.Cmd) {
 			log.WithField("ID", *nodeID).Info("Using node id")
 		}
 
-		vc := vault.Vault()
+		mc := meshContext()
 
-		meshInfo, err := vc.ReadMeetingPoint(*meshName)
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
 		if err != nil {
 			log.WithError(err).Trace("internal error")
 			log.Errorf("Unable to join network: %s", err)
@@ -40,7 +40,7 @@ func Leave(cmd *cli.Cmd) {
 			os.Exit(exitUnableToLeave)
 		}
 
-		err = vc.Leave(&vault.LeaveRequest{
+		err = mc.Leave(&mesh.LeaveRequest{
 			MeshName: *meshName,
 			MeshInfo: meshInfo,
 			NodeID:   *nodeID,
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// List implements the "list" cli command
+func List(cmd *cli.Cmd) {
+	cmd.Spec = "[--json]"
+	var (
+		asJSON = cmd.BoolOpt("json", false, "Print meshes as JSON")
+	)
+
+	cmd.Action = func() {
+		reg := newRegistry()
+
+		names, err := reg.ListMeshes()
+		if err != nil {
+			log.WithError(err).Error("Unable to list mesh networks")
+			os.Exit(exitUnableToList)
+		}
+		log.WithField("names", names).Trace("list.dump")
+
+		meshes := make([]*model.MeshInfo, 0, len(names))
+		for _, name := range names {
+			meshInfo, err := reg.ReadMeetingPoint(name)
+			if err != nil {
+				log.WithError(err).Errorf("Unable to read mesh network: %s", name)
+				os.Exit(exitUnableToList)
+			}
+			if meshInfo == nil {
+				continue
+			}
+			meshes = append(meshes, meshInfo)
+		}
+
+		if *asJSON {
+			b, err := json.MarshalIndent(meshes, "", "  ")
+			if err != nil {
+				log.WithError(err).Error("Unable to marshal mesh networks")
+				os.Exit(exitUnableToList)
+			}
+			fmt.Println(string(b))
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tNETWORK\tRESERVED\tNODE TTL")
+		for _, mi := range meshes {
+			ttl := "-"
+			if mi.NodeTTL > 0 {
+				ttl = fmt.Sprintf("%ds", mi.NodeTTL)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				mi.Name, strings.Join(mi.Networks(), ","), strings.Join(mi.ReservedRanges, ","), ttl)
+		}
+		w.Flush()
+	}
+}
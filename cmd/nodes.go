@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Nodes implements the "nodes" cli command
+func Nodes(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> [--id=<NODE-ID>] [--ip=<IP-OR-CIDR>] [--state=<STATE>] [--format=<FORMAT>]"
+	var (
+		meshName = cmd.StringOpt("name", "", "Name of the mesh to list nodes of")
+		nodeID   = cmd.StringOpt("id", "", "Only show nodes whose identifier starts with this prefix")
+		ipFilter = cmd.StringOpt("ip", "", "Only show nodes with an overlay IP equal to or within this IP or CIDR")
+		state    = cmd.StringOpt("state", "", "Only show nodes in this state: active, expired")
+		format   = cmd.StringOpt("format", "table", "Output format: table, json, csv")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+
+		var ipNet *net.IPNet
+		if *ipFilter != "" {
+			var err error
+			if strings.Contains(*ipFilter, "/") {
+				_, ipNet, err = net.ParseCIDR(*ipFilter)
+			} else if ip := net.ParseIP(*ipFilter); ip != nil {
+				ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))}
+			} else {
+				err = fmt.Errorf("invalid ip: %s", *ipFilter)
+			}
+			if err != nil {
+				log.WithError(err).Errorf("Must supply a valid IP or CIDR using --ip.")
+				os.Exit(exitInvalidParam)
+			}
+		}
+		if *state != "" && *state != "active" && *state != "expired" {
+			log.Errorf("--state must be one of: active, expired.")
+			os.Exit(exitInvalidParam)
+		}
+		if *format != "table" && *format != "json" && *format != "csv" {
+			log.Errorf("--format must be one of: table, json, csv.")
+			os.Exit(exitInvalidParam)
+		}
+
+		reg := newRegistry()
+
+		meshInfo, err := reg.ReadMeetingPoint(*meshName)
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to read mesh network: %s", err)
+		}
+		if meshInfo == nil {
+			os.Exit(exitUnableToList)
+		}
+
+		nodes, err := reg.ReadNodes(*meshName)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to read nodes of mesh: %s", *meshName)
+			os.Exit(exitUnableToList)
+		}
+
+		now := time.Now()
+		res := make(model.Nodes, 0, len(nodes))
+		for _, ni := range nodes {
+			if *nodeID != "" && !strings.HasPrefix(ni.NodeID, *nodeID) {
+				continue
+			}
+			if ipNet != nil && !nodeInNet(ni, ipNet) {
+				continue
+			}
+			expired := meshInfo.IsExpired(ni, now)
+			if (*state == "active" && expired) || (*state == "expired" && !expired) {
+				continue
+			}
+			res = append(res, ni)
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].NodeID < res[j].NodeID
+		})
+
+		switch *format {
+		case "json":
+			b, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				log.WithError(err).Error("Unable to marshal nodes")
+				os.Exit(exitUnableToList)
+			}
+			fmt.Println(string(b))
+		case "csv":
+			w := csv.NewWriter(os.Stdout)
+			w.Write([]string{"id", "wgip", "wgip6", "pubkey", "endpointIP", "endpointPort", "lastSeen", "expired"})
+			for _, ni := range res {
+				w.Write([]string{
+					ni.NodeID, ni.WireguardIP, ni.WireguardIP6, ni.WireguardPublicKey,
+					ni.ExternalIP, strconv.Itoa(ni.ListenPort), formatLastSeen(ni.LastSeen),
+					strconv.FormatBool(meshInfo.IsExpired(ni, now)),
+				})
+			}
+			w.Flush()
+		default:
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tIP\tPUBKEY\tENDPOINT\tLAST SEEN\tEXPIRED")
+			for _, ni := range res {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n",
+					ni.NodeID, strings.Join(ni.WireguardIPs(), ","), ni.WireguardPublicKey,
+					net.JoinHostPort(ni.ExternalIP, strconv.Itoa(ni.ListenPort)),
+					formatLastSeen(ni.LastSeen), meshInfo.IsExpired(ni, now))
+			}
+			w.Flush()
+		}
+	}
+}
+
+func nodeInNet(ni model.NodeInfo, ipNet *net.IPNet) bool {
+	for _, ip := range ni.WireguardIPs() {
+		if ipNet.Contains(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatLastSeen(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Policy implements the "policy" cli command
+func Policy(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> --role=<ROLE> [--write [--policy-name=<POLICY-NAME>]]"
+	var (
+		meshName   = cmd.StringOpt("name", "", "Name of the mesh to generate a policy for")
+		role       = cmd.StringOpt("role", "", "Role to generate a policy for: admin, member or reader")
+		write      = cmd.BoolOpt("write", false, "Write the policy to vault instead of printing it")
+		policyName = cmd.StringOpt("policy-name", "", "Name of the policy to write. Default: wgvam-<MESH-NAME>-<ROLE>")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+		switch *role {
+		case vault.PolicyRoleAdmin, vault.PolicyRoleMember, vault.PolicyRoleReader:
+		default:
+			log.Errorf("Must set a role using --role, one of admin, member or reader.")
+			os.Exit(exitInvalidParam)
+		}
+		log.WithField("role", *role).Trace("Param")
+		if *policyName == "" {
+			*policyName = vault.PolicyName(*meshName, *role)
+		}
+		log.WithField("policy-name", *policyName).Trace("Param")
+
+		vc, ok := newRegistry().(*vault.Context)
+		if !ok {
+			log.Errorf("Policies are only supported by the vault backend.")
+			os.Exit(exitInvalidParam)
+		}
+
+		policy, err := vc.Policy(*meshName, *role)
+		if err != nil {
+			log.WithError(err).Error("Unable to generate policy")
+			os.Exit(exitInvalidParam)
+		}
+
+		if !*write {
+			fmt.Print(policy)
+			if *role == vault.PolicyRoleAdmin {
+				fmt.Printf("\n# invites need the token role %s, which is created using --write\n", vault.InviteRoleName(*meshName))
+			}
+			return
+		}
+
+		if err := vc.WritePolicy(*meshName, *policyName, policy); err != nil {
+			log.WithError(err).Errorf("Unable to write policy: %s", *policyName)
+			os.Exit(exitUnableToWritePolicy)
+		}
+		fmt.Printf("Policy '%s' written.\n", *policyName)
+
+		if *role == vault.PolicyRoleAdmin {
+			if err := vc.WriteInviteRole(*meshName); err != nil {
+				log.WithError(err).Errorf("Unable to write token role: %s", vault.InviteRoleName(*meshName))
+				os.Exit(exitUnableToWritePolicy)
+			}
+			fmt.Printf("Token role '%s' written.\n", vault.InviteRoleName(*meshName))
+		}
+	}
+}
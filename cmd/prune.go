@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Prune implements the "prune" cli command
+func Prune(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> [--dry-run]"
+	var (
+		meshName = cmd.StringOpt("name", "", "Name of the mesh to prune expired nodes from")
+		dryRun   = cmd.BoolOpt("dry-run", false, "Only show expired nodes, do not delete them")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+
+		mc := meshContext()
+
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to read mesh network: %s", err)
+		}
+		if meshInfo == nil {
+			os.Exit(exitUnableToPrune)
+		}
+		if meshInfo.NodeTTL <= 0 {
+			log.Warnf("Mesh network '%s' has no node TTL, nodes never expire.", *meshName)
+		}
+
+		pruned, err := mc.Prune(&mesh.PruneRequest{
+			MeshName: *meshName,
+			MeshInfo: meshInfo,
+			DryRun:   *dryRun,
+		})
+		if err != nil {
+			log.WithError(err).Errorf("Unable to prune mesh: %s", *meshName)
+			os.Exit(exitUnableToPrune)
+		}
+		for _, nodeID := range pruned {
+			if *dryRun {
+				fmt.Printf("Node '%s' expired.\n", nodeID)
+			} else {
+				fmt.Printf("Node '%s' pruned.\n", nodeID)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/consul"
+	"github.com/aschmidt75/wireguard-vault-automesh/file"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	log "github.com/sirupsen/logrus"
+)
+
+// newRegistry returns the registry backend storing meeting points and node data,
+// as given by --backend. Supported are "vault" for Vault's KV secrets engine (default),
+// "consul://[host:port]/[prefix]" for Consul's KV store and "file:///path" for JSON
+// files within a local or shared directory. The address of vault is given
+// by --addr, not within the backend.
+func newRegistry() registry.Registry {
+	backend := config.Config().Backend
+
+	u, err := url.Parse(backend)
+	if err != nil {
+		log.WithError(err).Errorf("Invalid backend: %s", backend)
+		os.Exit(exitInvalidParam)
+	}
+
+	switch {
+	case IsVaultBackend():
+		vc := vault.Vault()
+		if vc == nil {
+			log.Error("Unable to create vault client. Please check address and credentials.")
+			os.Exit(exitUnableToAccessRegistry)
+		}
+		return vc
+	case u.Scheme == "vault":
+		log.Errorf("Unsupported backend: %s. Use --backend=vault and set the address using --addr.", backend)
+		os.Exit(exitInvalidParam)
+	case u.Scheme == "consul":
+		cc := consul.Consul(u.Host, u.Path)
+		if cc == nil {
+			log.Error("Unable to create consul client. Please check address.")
+			os.Exit(exitUnableToAccessRegistry)
+		}
+		return cc
+	case u.Scheme == "file":
+		if u.Path == "" {
+			log.Errorf("Must supply a directory for the file backend, e.g. file:///var/lib/wgvam")
+			os.Exit(exitInvalidParam)
+		}
+		return file.Directory(u.Path)
+	}
+
+	log.Errorf("Unsupported backend: %s", backend)
+	os.Exit(exitInvalidParam)
+	return nil
+}
+
+// IsVaultBackend checks if --backend selects vault
+func IsVaultBackend() bool {
+	return config.Config().Backend == "vault"
+}
+
+// meshContext returns a mesh context bound to the registry backend
+func meshContext() *mesh.Context {
+	return mesh.New(newRegistry())
+}
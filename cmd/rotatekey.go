@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// RotateKey implements the "rotate-key" cli command
+func RotateKey(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> [--id=<NODE-ID>] [--grace=<time_in_secs>] [--no-wait]"
+	var (
+		meshName  = cmd.StringOpt("name", "", "Name of the mesh to rotate the key for. Must have been joined before.")
+		nodeID    = cmd.StringOpt("id", "", "Identifier of this node. Must be unique across the mesh. Optional, defaults to MD5 of hostname")
+		graceSecs = cmd.IntOpt("grace", int(mesh.DefaultKeyRotationGrace/time.Second), "Number of seconds peers have to install the new key before the rotation is cancelled")
+		noWait    = cmd.BoolOpt("no-wait", false, "Only announce the new key, leave the switch to a running agent or the next update")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+		if *nodeID == "" {
+			*nodeID = config.UniqueID()
+			log.WithField("ID", *nodeID).Info("Using node id")
+		}
+		log.WithField("id", *nodeID).Trace("Param")
+		if *graceSecs <= 0 {
+			log.Errorf("--grace must be greater than 0.")
+			os.Exit(exitInvalidParam)
+		}
+
+		mc := meshContext()
+
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to read mesh network: %s", err)
+		}
+		if meshInfo == nil {
+			os.Exit(exitUnableToRotateKey)
+		}
+
+		err = mc.RotateKey(&mesh.RotateKeyRequest{
+			MeshName: *meshName,
+			MeshInfo: meshInfo,
+			NodeID:   *nodeID,
+			Grace:    time.Duration(*graceSecs) * time.Second,
+			Wait:     !*noWait,
+		})
+		if err != nil {
+			log.WithError(err).Errorf("Unable to rotate key in mesh: %s", *meshName)
+			os.Exit(exitUnableToRotateKey)
+		}
+		if *noWait {
+			fmt.Printf("Announced new key in mesh network '%s'.\n", *meshName)
+		} else {
+			fmt.Printf("Rotated key in mesh network '%s'.\n", *meshName)
+		}
+	}
+}
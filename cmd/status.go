@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status implements the "status" cli command
+func Status(cmd *cli.Cmd) {
+	cmd.Spec = "--name=<MESH-NAME> [--id=<NODE-ID>] [--json]"
+	var (
+		meshName = cmd.StringOpt("name", "", "Name of the mesh to show the status of")
+		nodeID   = cmd.StringOpt("id", "", "Identifier of this node. Must be unique across the mesh. Optional, defaults to MD5 of hostname")
+		asJSON   = cmd.BoolOpt("json", false, "Print status as JSON")
+	)
+
+	cmd.Action = func() {
+		if *meshName == "" {
+			log.Errorf("Must set a name for the mesh using --name.")
+			os.Exit(exitMissingParams)
+		}
+		log.WithField("name", *meshName).Trace("Param")
+		if *nodeID == "" {
+			*nodeID = config.UniqueID()
+			log.WithField("ID", *nodeID).Debug("Using node id")
+		}
+		log.WithField("id", *nodeID).Trace("Param")
+
+		mc := meshContext()
+
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
+		if err != nil {
+			log.WithError(err).Trace("internal error")
+			log.Errorf("Unable to read mesh network: %s", err)
+		}
+		if meshInfo == nil {
+			os.Exit(exitUnableToQueryStatus)
+		}
+
+		status, err := mc.Status(&mesh.StatusRequest{
+			MeshName: *meshName,
+			NodeID:   *nodeID,
+			MeshInfo: meshInfo,
+		})
+		if err != nil {
+			log.WithError(err).Errorf("Unable to query status of mesh: %s", *meshName)
+			os.Exit(exitUnableToQueryStatus)
+		}
+
+		if *asJSON {
+			b, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				log.WithError(err).Error("Unable to marshal status")
+				os.Exit(exitUnableToQueryStatus)
+			}
+			fmt.Println(string(b))
+			return
+		}
+
+		printStatus(status)
+	}
+}
+
+func printStatus(status *mesh.MeshStatus) {
+	fmt.Printf("Mesh:      %s (%s)\n", status.MeshInfo.Name, strings.Join(status.MeshInfo.Networks(), ", "))
+	if status.InterfacePresent {
+		fmt.Printf("Interface: %s\n\n", status.InterfaceName)
+	} else {
+		fmt.Printf("Interface: %s (not present)\n\n", status.InterfaceName)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIP\tENDPOINT\tHANDSHAKE\tRX\tTX\tSTATUS")
+	for _, ns := range status.Nodes {
+		state := "ok"
+		switch {
+		case ns.Self:
+			state = "self"
+		case ns.Expired:
+			state = "expired"
+		case !ns.PeerPresent:
+			state = "missing locally"
+		}
+		handshake := "-"
+		if !ns.Self {
+			handshake = formatHandshake(ns.LastHandshake)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			ns.NodeID, strings.Join(ns.WireguardIPs, ","), ns.Endpoint,
+			handshake, ns.ReceiveBytes, ns.TransmitBytes, state)
+	}
+	for _, peer := range status.UnknownPeers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			"-", strings.Join(peer.AllowedIPs, ","), peer.Endpoint,
+			formatHandshake(peer.LastHandshake), peer.ReceiveBytes, peer.TransmitBytes, "not in registry")
+	}
+	w.Flush()
+}
+
+func formatHandshake(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s ago", time.Since(t).Round(time.Second))
+}
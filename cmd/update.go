@@ -4,7 +4,7 @@ import (
 	"os"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/config"
-	"github.com/aschmidt75/wireguard-vault-automesh/vault"
+	"github.com/aschmidt75/wireguard-vault-automesh/mesh"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
 )
@@ -33,9 +33,9 @@ func Update(cmd *cli.Cmd) {
 			*waitSecs = 0
 		}
 
-		vc := vault.Vault()
+		mc := meshContext()
 
-		meshInfo, err := vc.ReadMeetingPoint(*meshName)
+		meshInfo, err := mc.ReadMeetingPoint(*meshName)
 		if err != nil {
 			log.WithError(err).Trace("internal error")
 			log.Errorf("Unable to join network: %s", err)
@@ -44,7 +44,7 @@ func Update(cmd *cli.Cmd) {
 			os.Exit(exitUnableToUpdate)
 		}
 
-		err = vc.Update(&vault.UpdateRequest{
+		err = mc.Update(&mesh.UpdateRequest{
 			MeshName: *meshName,
 			MeshInfo: meshInfo,
 			NodeID:   *nodeID,
@@ -10,11 +10,43 @@ type Configuration struct {
 	Debug   bool `env:"WGVAM_LOG_DEBUG" envDefault:"false"`
 	Verbose bool `env:"WGVAM_LOG_VERBOSE" envDefault:"true"`
 
+	Backend string `env:"WGVAM_BACKEND" envDefault:"vault"`
+
 	VaultAddr       string `env:"WGVAM_VAULT_ADDR" envDefault:"http://127.0.0.1:8200/"`
 	VaultToken      string `env:"WGVAM_VAULT_TOKEN" envDefault:""`
 	VaultEnginePath string `env:"WGVAM_VAULT_ENGINE_PATH" envDefault:"/wgvam"`
+	VaultAuth       string `env:"WGVAM_VAULT_AUTH" envDefault:"token"`
+	VaultKVVersion  int    `env:"WGVAM_VAULT_KV_VERSION" envDefault:"0"`
+
+	VaultTransitPath string `env:"WGVAM_VAULT_TRANSIT_PATH" envDefault:"/transit"`
+
+	VaultNamespace      string `env:"WGVAM_VAULT_NAMESPACE" envDefault:""`
+	VaultMeshNamespaces string `env:"WGVAM_VAULT_MESH_NAMESPACES" envDefault:""`
+
+	VaultCACert        string `env:"WGVAM_VAULT_CACERT" envDefault:""`
+	VaultClientCert    string `env:"WGVAM_VAULT_CLIENT_CERT" envDefault:""`
+	VaultClientKey     string `env:"WGVAM_VAULT_CLIENT_KEY" envDefault:""`
+	VaultTLSServerName string `env:"WGVAM_VAULT_TLS_SERVER_NAME" envDefault:""`
+
+	VaultAppRoleMount        string `env:"WGVAM_VAULT_APPROLE_MOUNT" envDefault:"approle"`
+	VaultAppRoleRoleID       string `env:"WGVAM_VAULT_APPROLE_ROLE_ID" envDefault:""`
+	VaultAppRoleRoleIDFile   string `env:"WGVAM_VAULT_APPROLE_ROLE_ID_FILE" envDefault:""`
+	VaultAppRoleSecretID     string `env:"WGVAM_VAULT_APPROLE_SECRET_ID" envDefault:""`
+	VaultAppRoleSecretIDFile string `env:"WGVAM_VAULT_APPROLE_SECRET_ID_FILE" envDefault:""`
+
+	VaultAuthMount string `env:"WGVAM_VAULT_AUTH_MOUNT" envDefault:""`
+	VaultAuthRole  string `env:"WGVAM_VAULT_AUTH_ROLE" envDefault:""`
+	VaultJWTPath   string `env:"WGVAM_VAULT_JWT_PATH" envDefault:""`
+
+	ConsulToken string `env:"WGVAM_CONSUL_TOKEN" envDefault:""`
 
-	DefaultEndpointListenPort int `env:"WGVAM_LISTEN_PORT" envDefault:"44444"`
+	DefaultEndpointListenPort int    `env:"WGVAM_LISTEN_PORT" envDefault:"44444"`
+	WireguardGoPath           string `env:"WGVAM_WIREGUARD_GO" envDefault:"wireguard-go"`
+
+	KeyDir   string `env:"WGVAM_KEY_DIR" envDefault:"/var/lib/wireguard-vault-automesh"`
+	KeyStore string `env:"WGVAM_KEY_STORE" envDefault:"file"`
+
+	RequireSignatures bool `env:"WGVAM_REQUIRE_SIGNATURES" envDefault:"false"`
 }
 
 var (
@@ -33,3 +65,14 @@ func Config() *Configuration {
 	}
 	return configuration
 }
+
+// Redacted returns a copy of the configuration without secrets, e.g. for logging
+func (c *Configuration) Redacted() Configuration {
+	res := *c
+	for _, secret := range []*string{&res.VaultToken, &res.VaultAppRoleSecretID, &res.ConsulToken} {
+		if *secret != "" {
+			*secret = "<redacted>"
+		}
+	}
+	return res
+}
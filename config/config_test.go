@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestRedacted(t *testing.T) {
+	c := &Configuration{
+		VaultAddr:            "https://vault:8200",
+		VaultToken:           "s.token",
+		VaultAppRoleRoleID:   "role",
+		VaultAppRoleSecretID: "secret",
+	}
+
+	r := c.Redacted()
+	if r.VaultToken != "<redacted>" || r.VaultAppRoleSecretID != "<redacted>" {
+		t.Errorf("secrets not redacted: %+v", r)
+	}
+	if r.ConsulToken != "" {
+		t.Errorf("empty consul token should stay empty, got %q", r.ConsulToken)
+	}
+	if r.VaultAddr != c.VaultAddr || r.VaultAppRoleRoleID != c.VaultAppRoleRoleID {
+		t.Errorf("other fields changed: %+v", r)
+	}
+	if c.VaultToken != "s.token" {
+		t.Errorf("original configuration changed: %+v", c)
+	}
+}
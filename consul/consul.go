@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/hashicorp/consul/api"
+)
+
+// Context contains links on how to connect to consul
+// and keeps the api client reference. It implements
+// registry.Registry using consul's KV store.
+type Context struct {
+	client *api.Client
+	prefix string
+
+	// lastIndex holds the index of the last node list read per mesh,
+	// used for blocking queries
+	lastIndex map[string]uint64
+	mu        sync.Mutex
+}
+
+var _ registry.Registry = &Context{}
+var _ registry.NodeWatcher = &Context{}
+
+// KeyPath constructs a consul key for a given mesh and subkey
+func (cc *Context) KeyPath(meshName, p string) string {
+	return fmt.Sprintf("%s/%s/%s", cc.prefix, meshName, p)
+}
+
+// Consul returns a Context for the consul agent at addr. All data
+// is stored below the key prefix.
+func Consul(addr string, prefix string) *Context {
+	c := config.Config()
+
+	cfg := api.DefaultConfig()
+	if addr != "" {
+		cfg.Address = addr
+	}
+	if c.ConsulToken != "" {
+		cfg.Token = c.ConsulToken
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = "wgvam"
+	}
+
+	return &Context{
+		client:    client,
+		prefix:    prefix,
+		lastIndex: make(map[string]uint64),
+	}
+}
+
+// KV returns consuls' api.KV struct
+func (cc *Context) KV() *api.KV {
+
+	return cc.client.KV()
+
+}
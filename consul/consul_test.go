@@ -0,0 +1,314 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeKV serves the subset of consul's KV http api used by Context,
+// including check-and-set writes.
+type fakeKV struct {
+	mu    sync.Mutex
+	index uint64
+	pairs map[string]*api.KVPair
+}
+
+func newFakeConsul(t *testing.T) (*Context, *fakeKV) {
+	kv := &fakeKV{pairs: make(map[string]*api.KVPair)}
+	srv := httptest.NewServer(kv)
+	t.Cleanup(srv.Close)
+
+	cc := Consul(srv.URL, "")
+	if cc == nil {
+		t.Fatal("unable to create consul client")
+	}
+	return cc, kv
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("index") != "" {
+		// blocking queries never see changes, they end with the request
+		// or after the wait time
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		select {
+		case <-r.Context().Done():
+		case <-time.After(wait):
+		}
+		return
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	q := r.URL.Query()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(kv.index, 10))
+
+	switch r.Method {
+	case http.MethodGet:
+		_, bKeys := q["keys"]
+		_, bRecurse := q["recurse"]
+		if bKeys || bRecurse {
+			keys := make([]string, 0)
+			for k := range kv.pairs {
+				if strings.HasPrefix(k, key) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			if bKeys {
+				json.NewEncoder(w).Encode(keys)
+				return
+			}
+			pairs := make([]*api.KVPair, 0, len(keys))
+			for _, k := range keys {
+				pairs = append(pairs, kv.pairs[k])
+			}
+			json.NewEncoder(w).Encode(pairs)
+			return
+		}
+		pair, ok := kv.pairs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]*api.KVPair{pair})
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		if cas := q.Get("cas"); cas != "" {
+			version, _ := strconv.ParseUint(cas, 10, 64)
+			var current uint64
+			if pair, ok := kv.pairs[key]; ok {
+				current = pair.ModifyIndex
+			}
+			if version != current {
+				fmt.Fprint(w, "false")
+				return
+			}
+		}
+		kv.index++
+		pair := &api.KVPair{Key: key, Value: body, CreateIndex: kv.index, ModifyIndex: kv.index}
+		if old, ok := kv.pairs[key]; ok {
+			pair.CreateIndex = old.CreateIndex
+		}
+		kv.pairs[key] = pair
+		fmt.Fprint(w, "true")
+	case http.MethodDelete:
+		delete(kv.pairs, key)
+		kv.index++
+		fmt.Fprint(w, "true")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestReserveIP(t *testing.T) {
+	type reservation struct {
+		ip     string
+		nodeID string
+		want   bool
+	}
+	tests := []struct {
+		name         string
+		reservations []reservation
+		wantOwners   map[string]string
+	}{
+		{"single reservation", []reservation{
+			{"10.0.0.1", "n1", true},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"same node again", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.1", "n1", true},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"conflict with other node", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.1", "n2", false},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"different ips", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.2", "n2", true},
+		}, map[string]string{"10.0.0.1": "n1", "10.0.0.2": "n2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc, _ := newFakeConsul(t)
+			for _, r := range tt.reservations {
+				got, err := cc.ReserveIP("mesh1", r.ip, r.nodeID)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if got != r.want {
+					t.Errorf("ReserveIP(%s, %s) is %v, want %v", r.ip, r.nodeID, got, r.want)
+				}
+			}
+
+			ips, err := cc.ReadIPs("mesh1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(ips) != len(tt.wantOwners) {
+				t.Errorf("got ips %v, want %d", ips, len(tt.wantOwners))
+			}
+			for ip, want := range tt.wantOwners {
+				owner, err := cc.ReadIPOwner("mesh1", ip)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if owner != want {
+					t.Errorf("owner of %s is %q, want %q", ip, owner, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterSigner(t *testing.T) {
+	cc, _ := newFakeConsul(t)
+
+	tests := []struct {
+		nodeID    string
+		publicKey string
+		want      bool
+	}{
+		{"n1", "key1", true},
+		{"n1", "key1", true},
+		{"n1", "key2", false},
+		{"n2", "key2", true},
+	}
+	for _, tt := range tests {
+		got, err := cc.RegisterSigner("mesh1", tt.nodeID, tt.publicKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != tt.want {
+			t.Errorf("RegisterSigner(%s, %s) is %v, want %v", tt.nodeID, tt.publicKey, got, tt.want)
+		}
+	}
+
+	signers, err := cc.ReadSigners("mesh1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(signers) != 2 || signers["n1"] != "key1" || signers["n2"] != "key2" {
+		t.Errorf("signers are %v", signers)
+	}
+}
+
+func TestWriteNodeDataCAS(t *testing.T) {
+	tests := []struct {
+		name    string
+		exists  bool
+		version func(read int) int
+		want    bool
+	}{
+		{"create with version 0", false, func(int) int { return 0 }, true},
+		{"create over existing entry", true, func(int) int { return 0 }, false},
+		{"update read version", true, func(read int) int { return read }, true},
+		{"update outdated version", true, func(read int) int { return read - 1 }, false},
+		{"update newer version", true, func(read int) int { return read + 1 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc, _ := newFakeConsul(t)
+			// entries of other keys advance the index as well
+			if err := cc.WriteNodeData("mesh1", model.NodeInfo{NodeID: "n0"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			read := 0
+			if tt.exists {
+				if err := cc.WriteNodeData("mesh1", model.NodeInfo{NodeID: "n1", ExternalIP: "192.0.2.1"}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				var err error
+				if _, read, err = cc.ReadNodeVersion("mesh1", "n1"); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			got, err := cc.WriteNodeDataCAS("mesh1", model.NodeInfo{NodeID: "n1", ExternalIP: "192.0.2.2"}, tt.version(read))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("WriteNodeDataCAS is %v, want %v", got, tt.want)
+			}
+
+			nodeInfo, _, err := cc.ReadNodeVersion("mesh1", "n1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			wantIP := "192.0.2.1"
+			if tt.want {
+				wantIP = "192.0.2.2"
+			}
+			if nodeInfo.ExternalIP != wantIP {
+				t.Errorf("endpoint ip is %q, want %q", nodeInfo.ExternalIP, wantIP)
+			}
+		})
+	}
+}
+
+func TestReadNodes(t *testing.T) {
+	cc, kv := newFakeConsul(t)
+
+	for _, id := range []string{"n1", "n2"} {
+		if err := cc.WriteNodeData("mesh1", model.NodeInfo{NodeID: id}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	kv.pairs[cc.KeyPath("mesh1", "nodes/n3")] = &api.KVPair{
+		Key:   cc.KeyPath("mesh1", "nodes/n3"),
+		Value: []byte(`{"nodeID":`),
+	}
+
+	nodes, err := cc.ReadNodes("mesh1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 2 || nodes["n1"].NodeID != "n1" || nodes["n2"].NodeID != "n2" {
+		t.Errorf("nodes are %v, want n1 and n2", nodes)
+	}
+}
+
+func TestWaitForNodeChangesCancel(t *testing.T) {
+	cc, _ := newFakeConsul(t)
+	if err := cc.WriteNodeData("mesh1", model.NodeInfo{NodeID: "n1"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := cc.ReadNodes("mesh1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- cc.WaitForNodeChanges(ctx, "mesh1", 10*time.Second)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error after cancelling")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForNodeChanges did not return after cancelling")
+	}
+}
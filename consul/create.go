@@ -0,0 +1,36 @@
+package consul
+
+import (
+	"encoding/json"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateMeetingPoint accesses consul to create the mesh namework data
+func (cc *Context) CreateMeetingPoint(mi model.MeshInfo) (bool, error) {
+	log.WithField("meshinfo", mi).Trace("dump")
+
+	body, err := json.Marshal(mi)
+	if err != nil {
+		log.WithError(err).Error("Error marshaling data")
+		return false, err
+	}
+
+	p := cc.KeyPath(mi.Name, "mp")
+	log.WithField("path", p).Trace("writing to consul")
+
+	// ModifyIndex 0 only writes if the key does not exist yet
+	ok, _, err := cc.KV().CAS(&api.KVPair{
+		Key:         p,
+		Value:       body,
+		ModifyIndex: 0,
+	}, nil)
+	if err != nil {
+		log.WithError(err).Error("Error writing to consul. Please check address and token.")
+		return false, err
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,34 @@
+package consul
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DeleteMeetingPoint accesses consul to delete the meeting point data of a mesh
+func (cc *Context) DeleteMeetingPoint(name string) (bool, error) {
+	p := cc.KeyPath(name, "mp")
+	log.WithField("path", p).Trace("Looking for meeting point")
+
+	pair, _, err := cc.KV().Get(p, nil)
+	if err != nil {
+		log.WithError(err).Error("Error reading from consul. Please check address and token.")
+		return false, err
+	}
+	if pair == nil {
+		log.Debug("No meeting point for named mesh")
+		return false, nil
+	}
+
+	if _, err = cc.KV().Delete(p, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteNode deletes the node data, indicated by nodeID and meshName
+func (cc *Context) DeleteNode(meshName string, nodeID string) error {
+	_, err := cc.KV().Delete(cc.KeyPath(meshName, fmt.Sprintf("nodes/%s", nodeID)), nil)
+	return err
+}
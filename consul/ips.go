@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// ipPath returns the subkey under which the reservation for ip is stored
+func ipPath(ip string) string {
+	return fmt.Sprintf("ips/%s", ip)
+}
+
+// ReserveIP tries to reserve the overlay ip for nodeID within meshName. It uses
+// a check-and-set write on ModifyIndex 0, so that only one node is able to create
+// the reservation. Returns true if the ip is reserved for nodeID (either by this
+// call or before), false if another node holds it.
+func (cc *Context) ReserveIP(meshName string, ip string, nodeID string) (bool, error) {
+	ok, _, err := cc.KV().CAS(&api.KVPair{
+		Key:         cc.KeyPath(meshName, ipPath(ip)),
+		Value:       []byte(nodeID),
+		ModifyIndex: 0,
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		log.WithFields(log.Fields{"ip": ip, "id": nodeID}).Debug("Reserved ip")
+		return true, nil
+	}
+
+	// already reserved, check if it's us
+	owner, err := cc.ReadIPOwner(meshName, ip)
+	if err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{"ip": ip, "owner": owner}).Trace("ip already reserved")
+
+	return owner == nodeID, nil
+}
+
+// ReadIPOwner returns the ID of the node which reserved ip, or an empty
+// string if ip is not reserved.
+func (cc *Context) ReadIPOwner(meshName string, ip string) (string, error) {
+	pair, _, err := cc.KV().Get(cc.KeyPath(meshName, ipPath(ip)), nil)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil {
+		return "", nil
+	}
+	return string(pair.Value), nil
+}
+
+// ReleaseIP removes the reservation of ip
+func (cc *Context) ReleaseIP(meshName string, ip string) error {
+	_, err := cc.KV().Delete(cc.KeyPath(meshName, ipPath(ip)), nil)
+	return err
+}
+
+// ReadIPs lists all reserved ips of a mesh
+func (cc *Context) ReadIPs(meshName string) ([]string, error) {
+	p := cc.KeyPath(meshName, "ips/")
+	keys, _, err := cc.KV().Keys(p, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, strings.TrimPrefix(key, p))
+	}
+	return res, nil
+}
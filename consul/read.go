@@ -0,0 +1,108 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListMeshes reads the names of all meshes below the key prefix
+func (cc *Context) ListMeshes() ([]string, error) {
+	p := fmt.Sprintf("%s/", cc.prefix)
+	log.WithField("path", p).Trace("Looking for meshes...")
+
+	keys, _, err := cc.KV().Keys(p, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// meshes are folders, listed with a trailing slash
+		if !strings.HasSuffix(key, "/") {
+			continue
+		}
+		res = append(res, strings.TrimSuffix(strings.TrimPrefix(key, p), "/"))
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// ReadMeetingPoint accesses consul to read the mesh namework data from the meeting point
+func (cc *Context) ReadMeetingPoint(meshName string) (*model.MeshInfo, error) {
+	p := cc.KeyPath(meshName, "mp")
+	log.WithField("path", p).Trace("Looking for meeting point")
+
+	pair, _, err := cc.KV().Get(p, nil)
+	if err != nil {
+		log.WithError(err).Error("Error reading from consul. Please check address and token")
+		return nil, err
+	}
+	if pair == nil {
+		log.Error("No meeting point data found for given network name")
+		return nil, nil
+	}
+
+	mi := &model.MeshInfo{}
+	if err = json.Unmarshal(pair.Value, mi); err != nil {
+		log.WithError(err).Error("Error parsing meeting point data")
+		return nil, err
+	}
+
+	log.WithField("mi", mi).Debug("meeting point data")
+
+	return mi, nil
+}
+
+// ReadNodes reads the list of nodes from consul
+func (cc *Context) ReadNodes(meshName string) (model.NodeMap, error) {
+	p := cc.KeyPath(meshName, "nodes/")
+	log.WithField("path", p).Trace("Looking for nodes...")
+
+	pairs, meta, err := cc.KV().List(p, nil)
+	if err != nil {
+		return nil, err
+	}
+	cc.setLastIndex(meshName, meta.LastIndex)
+
+	res := make(model.NodeMap, len(pairs))
+	for _, pair := range pairs {
+		nodeInfo := model.NodeInfo{}
+		if err := json.Unmarshal(pair.Value, &nodeInfo); err != nil {
+			// a tampered entry must not keep all others from being read
+			log.WithError(err).WithField("key", pair.Key).Error("Skipping malformed node entry")
+			continue
+		}
+		res[strings.TrimPrefix(pair.Key, p)] = nodeInfo
+	}
+
+	return res, nil
+}
+
+// ReadNode reads a single node data from consul
+func (cc *Context) ReadNode(meshName, key string) (model.NodeInfo, error) {
+	res, _, err := cc.ReadNodeVersion(meshName, key)
+	return res, err
+}
+
+// ReadNodeVersion reads a single node along with the ModifyIndex of its entry
+func (cc *Context) ReadNodeVersion(meshName, key string) (model.NodeInfo, int, error) {
+	res := model.NodeInfo{}
+
+	pair, _, err := cc.KV().Get(cc.KeyPath(meshName, fmt.Sprintf("nodes/%s", key)), nil)
+	if err != nil {
+		return res, 0, err
+	}
+	if pair == nil {
+		return res, 0, registry.ErrNodeNotFound
+	}
+
+	err = json.Unmarshal(pair.Value, &res)
+	return res, int(pair.ModifyIndex), err
+}
@@ -0,0 +1,60 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// signerPath returns the subkey under which the signing key of nodeID is stored
+func signerPath(nodeID string) string {
+	return fmt.Sprintf("signers/%s", nodeID)
+}
+
+// RegisterSigner stores the public signing key of nodeID using a CAS write with
+// index 0, so that it cannot be replaced. Returns true if publicKey is registered
+// for nodeID (either by this call or before), false if another key is registered.
+func (cc *Context) RegisterSigner(meshName string, nodeID string, publicKey string) (bool, error) {
+	ok, _, err := cc.KV().CAS(&api.KVPair{
+		Key:         cc.KeyPath(meshName, signerPath(nodeID)),
+		Value:       []byte(publicKey),
+		ModifyIndex: 0,
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		log.WithField("id", nodeID).Debug("Registered signer")
+		return true, nil
+	}
+
+	pair, _, err := cc.KV().Get(cc.KeyPath(meshName, signerPath(nodeID)), nil)
+	if err != nil || pair == nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{"id": nodeID, "publicKey": string(pair.Value)}).Trace("signer already registered")
+
+	return string(pair.Value) == publicKey, nil
+}
+
+// ReadSigners reads the public signing keys of all nodes of a mesh
+func (cc *Context) ReadSigners(meshName string) (map[string]string, error) {
+	p := cc.KeyPath(meshName, "signers/")
+	pairs, _, err := cc.KV().List(p, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		res[strings.TrimPrefix(pair.Key, p)] = string(pair.Value)
+	}
+	return res, nil
+}
+
+// DeleteSigner deletes the public signing key of nodeID
+func (cc *Context) DeleteSigner(meshName string, nodeID string) error {
+	_, err := cc.KV().Delete(cc.KeyPath(meshName, signerPath(nodeID)), nil)
+	return err
+}
@@ -0,0 +1,54 @@
+package consul
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+func (cc *Context) setLastIndex(meshName string, index uint64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.lastIndex[meshName] = index
+}
+
+func (cc *Context) getLastIndex(meshName string) uint64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.lastIndex[meshName]
+}
+
+// WaitForNodeChanges uses a blocking query on the nodes prefix of meshName
+// to wait until node entries change after the last call to ReadNodes, until
+// timeout has passed or until ctx is cancelled.
+func (cc *Context) WaitForNodeChanges(ctx context.Context, meshName string, timeout time.Duration) error {
+	p := cc.KeyPath(meshName, "nodes/")
+
+	index := cc.getLastIndex(meshName)
+	if index == 0 {
+		// nodes have not been read yet, fetch current index first
+		_, meta, err := cc.KV().Keys(p, "", (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		index = meta.LastIndex
+	}
+
+	log.WithFields(log.Fields{
+		"path":  p,
+		"index": index,
+	}).Trace("Waiting for node changes...")
+
+	_, meta, err := cc.KV().Keys(p, "", (&api.QueryOptions{
+		WaitIndex: index,
+		WaitTime:  timeout,
+	}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	log.WithField("index", meta.LastIndex).Trace("WaitForNodeChanges.dump")
+
+	return nil
+}
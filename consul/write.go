@@ -0,0 +1,48 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// WriteNodeData writes the nodeInfo to the nodelist of meshName
+func (cc *Context) WriteNodeData(meshName string, nodeInfo model.NodeInfo) error {
+	body, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"data": string(body),
+	}).Trace("writing to consul")
+
+	_, err = cc.KV().Put(&api.KVPair{
+		Key:   cc.KeyPath(meshName, fmt.Sprintf("nodes/%s", nodeInfo.NodeID)),
+		Value: body,
+	}, nil)
+	return err
+}
+
+// WriteNodeDataCAS writes the nodeInfo to the nodelist of meshName if its
+// entry still has the ModifyIndex version. Returns false if it has been
+// changed in the meantime.
+func (cc *Context) WriteNodeDataCAS(meshName string, nodeInfo model.NodeInfo, version int) (bool, error) {
+	body, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{
+		"data": string(body),
+		"cas":  version,
+	}).Trace("writing to consul")
+
+	ok, _, err := cc.KV().CAS(&api.KVPair{
+		Key:         cc.KeyPath(meshName, fmt.Sprintf("nodes/%s", nodeInfo.NodeID)),
+		Value:       body,
+		ModifyIndex: uint64(version),
+	}, nil)
+	return ok, err
+}
@@ -0,0 +1,38 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateMeetingPoint creates the file with the mesh namework data
+func (fc *Context) CreateMeetingPoint(mi model.MeshInfo) (bool, error) {
+	log.WithField("meshinfo", mi).Trace("dump")
+
+	body, err := json.Marshal(mi)
+	if err != nil {
+		log.WithError(err).Error("Error marshaling data")
+		return false, err
+	}
+
+	p := fc.FilePath(mi.Name, "mp.json")
+	log.WithField("path", p).Trace("Looking for meeting point")
+
+	bCreated := false
+	err = fc.withLock(mi.Name, func() error {
+		if _, err := os.Stat(p); err == nil {
+			return nil
+		}
+		bCreated = true
+		return writeFile(p, body)
+	})
+	if err != nil {
+		log.WithError(err).Error("Error writing meeting point file")
+		return false, err
+	}
+
+	return bCreated, nil
+}
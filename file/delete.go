@@ -0,0 +1,31 @@
+package file
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DeleteMeetingPoint removes the meeting point file and the directory of a mesh
+func (fc *Context) DeleteMeetingPoint(name string) (bool, error) {
+	p := fc.FilePath(name, "mp.json")
+	log.WithField("path", p).Trace("Looking for meeting point")
+
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		log.Debug("No meeting point for named mesh")
+		return false, nil
+	}
+
+	if err := os.Remove(p); err != nil {
+		return false, err
+	}
+	if err := os.RemoveAll(fc.FilePath(name)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteNode removes the node data file, indicated by nodeID and meshName
+func (fc *Context) DeleteNode(meshName string, nodeID string) error {
+	return removeFile(fc.FilePath(meshName, "nodes", nodeID+".json"))
+}
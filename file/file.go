@@ -0,0 +1,101 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// Context keeps the base directory of a file based registry. It
+// implements registry.Registry by storing meeting points and node
+// entries as JSON files, one directory per mesh:
+//
+//	<dir>/<mesh>/mp.json
+//	<dir>/<mesh>/nodes/<node id>.json
+//	<dir>/<mesh>/ips/<ip>
+//	<dir>/<mesh>/signers/<node id>
+type Context struct {
+	dir string
+}
+
+var _ registry.Registry = &Context{}
+
+const (
+	lockFileName = ".lock"
+	dirMode      = 0700
+	fileMode     = 0600
+)
+
+// Directory returns a Context storing all data below dir
+func Directory(dir string) *Context {
+	return &Context{
+		dir: filepath.Clean(dir),
+	}
+}
+
+// FilePath constructs a file path for a given mesh and subpath
+func (fc *Context) FilePath(meshName string, p ...string) string {
+	return filepath.Join(append([]string{fc.dir, meshName}, p...)...)
+}
+
+// withLock runs fn while holding an exclusive lock on the mesh directory
+func (fc *Context) withLock(meshName string, fn func() error) error {
+	if err := os.MkdirAll(fc.FilePath(meshName), dirMode); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fc.FilePath(meshName, lockFileName), os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	log.WithField("mesh", meshName).Trace("Acquired lock")
+
+	return fn()
+}
+
+// writeFile atomically replaces the file at p with data, by
+// writing to a temporary file and renaming it.
+func writeFile(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), dirMode); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// removeFile removes the file at p, it is not an error if it does not exist
+func removeFile(p string) error {
+	err := os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
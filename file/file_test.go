@@ -0,0 +1,298 @@
+package file
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+)
+
+func TestReserveIP(t *testing.T) {
+	type reservation struct {
+		ip     string
+		nodeID string
+		want   bool
+	}
+	tests := []struct {
+		name         string
+		reservations []reservation
+		wantOwners   map[string]string
+	}{
+		{"single reservation", []reservation{
+			{"10.0.0.1", "n1", true},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"same node again", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.1", "n1", true},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"conflict with other node", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.1", "n2", false},
+		}, map[string]string{"10.0.0.1": "n1"}},
+		{"different ips", []reservation{
+			{"10.0.0.1", "n1", true},
+			{"10.0.0.2", "n2", true},
+		}, map[string]string{"10.0.0.1": "n1", "10.0.0.2": "n2"}},
+		{"ipv6", []reservation{
+			{"fd00::1", "n1", true},
+			{"fd00::1", "n2", false},
+		}, map[string]string{"fd00::1": "n1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := Directory(t.TempDir())
+			for _, r := range tt.reservations {
+				got, err := fc.ReserveIP("mesh1", r.ip, r.nodeID)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if got != r.want {
+					t.Errorf("ReserveIP(%s, %s) is %v, want %v", r.ip, r.nodeID, got, r.want)
+				}
+			}
+
+			ips, err := fc.ReadIPs("mesh1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(ips) != len(tt.wantOwners) {
+				t.Errorf("got ips %v, want %d", ips, len(tt.wantOwners))
+			}
+			for ip, want := range tt.wantOwners {
+				owner, err := fc.ReadIPOwner("mesh1", ip)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if owner != want {
+					t.Errorf("owner of %s is %q, want %q", ip, owner, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveIPConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	nodeIDs := []string{"n1", "n2", "n3", "n4", "n5", "n6", "n7", "n8"}
+
+	var wg sync.WaitGroup
+	results := make([]bool, len(nodeIDs))
+	errs := make([]error, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		wg.Add(1)
+		go func(i int, nodeID string) {
+			defer wg.Done()
+			// separate contexts, as separate processes would use
+			results[i], errs[i] = Directory(dir).ReserveIP("mesh1", "10.0.0.1", nodeID)
+		}(i, nodeID)
+	}
+	wg.Wait()
+
+	winner := ""
+	for i, nodeID := range nodeIDs {
+		if errs[i] != nil {
+			t.Fatalf("unexpected error for %s: %s", nodeID, errs[i])
+		}
+		if !results[i] {
+			continue
+		}
+		if winner != "" {
+			t.Fatalf("ip reserved for %s and %s", winner, nodeID)
+		}
+		winner = nodeID
+	}
+	if winner == "" {
+		t.Fatal("ip not reserved for any node")
+	}
+
+	owner, err := Directory(dir).ReadIPOwner("mesh1", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if owner != winner {
+		t.Errorf("owner is %q, want %q", owner, winner)
+	}
+}
+
+func TestReleaseIP(t *testing.T) {
+	fc := Directory(t.TempDir())
+
+	if err := fc.ReleaseIP("mesh1", "10.0.0.1"); err != nil {
+		t.Fatalf("releasing an unreserved ip: %s", err)
+	}
+	if ok, err := fc.ReserveIP("mesh1", "10.0.0.1", "n1"); err != nil || !ok {
+		t.Fatalf("ReserveIP is %v, %v", ok, err)
+	}
+	if err := fc.ReleaseIP("mesh1", "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ok, err := fc.ReserveIP("mesh1", "10.0.0.1", "n2"); err != nil || !ok {
+		t.Errorf("ReserveIP after release is %v, %v", ok, err)
+	}
+}
+
+func TestRegisterSigner(t *testing.T) {
+	type registration struct {
+		nodeID    string
+		publicKey string
+		want      bool
+	}
+	tests := []struct {
+		name          string
+		registrations []registration
+		wantSigners   map[string]string
+	}{
+		{"single signer", []registration{
+			{"n1", "key1", true},
+		}, map[string]string{"n1": "key1"}},
+		{"same key again", []registration{
+			{"n1", "key1", true},
+			{"n1", "key1", true},
+		}, map[string]string{"n1": "key1"}},
+		{"other key is rejected", []registration{
+			{"n1", "key1", true},
+			{"n1", "key2", false},
+		}, map[string]string{"n1": "key1"}},
+		{"several nodes", []registration{
+			{"n1", "key1", true},
+			{"n2", "key2", true},
+		}, map[string]string{"n1": "key1", "n2": "key2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := Directory(t.TempDir())
+			for _, r := range tt.registrations {
+				got, err := fc.RegisterSigner("mesh1", r.nodeID, r.publicKey)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if got != r.want {
+					t.Errorf("RegisterSigner(%s, %s) is %v, want %v", r.nodeID, r.publicKey, got, r.want)
+				}
+			}
+
+			signers, err := fc.ReadSigners("mesh1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(signers) != len(tt.wantSigners) {
+				t.Errorf("got signers %v, want %v", signers, tt.wantSigners)
+			}
+			for nodeID, want := range tt.wantSigners {
+				if signers[nodeID] != want {
+					t.Errorf("signer of %s is %q, want %q", nodeID, signers[nodeID], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateMeetingPoint(t *testing.T) {
+	fc := Directory(t.TempDir())
+	mi := model.MeshInfo{Name: "mesh1", NetworkCIDR: "10.0.0.0/24"}
+
+	if ok, err := fc.CreateMeetingPoint(mi); err != nil || !ok {
+		t.Fatalf("CreateMeetingPoint is %v, %v", ok, err)
+	}
+	other := mi
+	other.NetworkCIDR = "10.1.0.0/24"
+	if ok, err := fc.CreateMeetingPoint(other); err != nil || ok {
+		t.Errorf("second CreateMeetingPoint is %v, %v, want false", ok, err)
+	}
+
+	got, err := fc.ReadMeetingPoint("mesh1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got == nil || got.NetworkCIDR != mi.NetworkCIDR {
+		t.Errorf("meeting point is %+v, want %+v", got, mi)
+	}
+
+	meshes, err := fc.ListMeshes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(meshes) != 1 || meshes[0] != "mesh1" {
+		t.Errorf("meshes are %v, want [mesh1]", meshes)
+	}
+}
+
+func TestReadNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantIDs []string
+	}{
+		{"no nodes", nil, nil},
+		{"valid nodes", map[string]string{
+			"n1.json": `{"nodeID":"n1"}`,
+			"n2.json": `{"nodeID":"n2"}`,
+		}, []string{"n1", "n2"}},
+		{"malformed json is skipped", map[string]string{
+			"n1.json": `{"nodeID":"n1"}`,
+			"n2.json": `{"nodeID":`,
+		}, []string{"n1"}},
+		{"wrong types are skipped", map[string]string{
+			"n1.json": `{"nodeID":"n1"}`,
+			"n2.json": `{"nodeID":42}`,
+		}, []string{"n1"}},
+		{"other files are ignored", map[string]string{
+			"n1.json":    `{"nodeID":"n1"}`,
+			".tmp-12345": `{"nodeID":`,
+		}, []string{"n1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := Directory(t.TempDir())
+			for name, body := range tt.files {
+				if err := writeFile(fc.FilePath("mesh1", "nodes", name), []byte(body)); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			nodes, err := fc.ReadNodes("mesh1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(nodes) != len(tt.wantIDs) {
+				t.Errorf("got nodes %v, want %v", nodes, tt.wantIDs)
+			}
+			for _, id := range tt.wantIDs {
+				if nodes[id].NodeID != id {
+					t.Errorf("node %s is %+v", id, nodes[id])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	fc := Directory(t.TempDir())
+	p := fc.FilePath("mesh1", "nodes", "n1.json")
+
+	for _, body := range []string{"first", "second"} {
+		if err := writeFile(p, []byte(body)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(got) != body {
+			t.Errorf("file contains %q, want %q", got, body)
+		}
+	}
+
+	// no temporary files are left behind
+	entries, err := ioutil.ReadDir(fc.FilePath("mesh1", "nodes"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want 1", len(entries))
+	}
+}
@@ -0,0 +1,81 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReserveIP tries to reserve the overlay ip for nodeID within meshName. The
+// reservation file is created exclusively while holding the mesh lock, so
+// that only one node is able to create it. Returns true if the ip is reserved
+// for nodeID (either by this call or before), false if another node holds it.
+func (fc *Context) ReserveIP(meshName string, ip string, nodeID string) (bool, error) {
+	bReserved := false
+	err := fc.withLock(meshName, func() error {
+		if err := os.MkdirAll(fc.FilePath(meshName, "ips"), dirMode); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(fc.FilePath(meshName, "ips", ip), os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+		if os.IsExist(err) {
+			// already reserved, check if it's us
+			owner, err := fc.ReadIPOwner(meshName, ip)
+			if err != nil {
+				return err
+			}
+			log.WithFields(log.Fields{"ip": ip, "owner": owner}).Trace("ip already reserved")
+			bReserved = (owner == nodeID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := f.WriteString(nodeID); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"ip": ip, "id": nodeID}).Debug("Reserved ip")
+		bReserved = true
+		return f.Sync()
+	})
+
+	return bReserved, err
+}
+
+// ReadIPOwner returns the ID of the node which reserved ip, or an empty
+// string if ip is not reserved.
+func (fc *Context) ReadIPOwner(meshName string, ip string) (string, error) {
+	body, err := ioutil.ReadFile(fc.FilePath(meshName, "ips", ip))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// ReleaseIP removes the reservation file of ip
+func (fc *Context) ReleaseIP(meshName string, ip string) error {
+	return removeFile(fc.FilePath(meshName, "ips", ip))
+}
+
+// ReadIPs lists all reserved ips of a mesh
+func (fc *Context) ReadIPs(meshName string) ([]string, error) {
+	res := make([]string, 0)
+
+	entries, err := ioutil.ReadDir(fc.FilePath(meshName, "ips"))
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		res = append(res, entry.Name())
+	}
+	return res, nil
+}
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListMeshes reads the names of all meshes within the base directory
+func (fc *Context) ListMeshes() ([]string, error) {
+	res := make([]string, 0)
+
+	entries, err := ioutil.ReadDir(fc.dir)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(fc.FilePath(entry.Name(), "mp.json")); err != nil {
+			continue
+		}
+		res = append(res, entry.Name())
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// ReadMeetingPoint reads the mesh namework data from the meeting point file
+func (fc *Context) ReadMeetingPoint(meshName string) (*model.MeshInfo, error) {
+	p := fc.FilePath(meshName, "mp.json")
+	log.WithField("path", p).Trace("Looking for meeting point")
+
+	body, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		log.Error("No meeting point data found for given network name")
+		return nil, nil
+	}
+	if err != nil {
+		log.WithError(err).Error("Error reading meeting point file")
+		return nil, err
+	}
+
+	mi := &model.MeshInfo{}
+	if err = json.Unmarshal(body, mi); err != nil {
+		log.WithError(err).Error("Error parsing meeting point data")
+		return nil, err
+	}
+
+	log.WithField("mi", mi).Debug("meeting point data")
+
+	return mi, nil
+}
+
+// ReadNodes reads the list of nodes from the nodes directory
+func (fc *Context) ReadNodes(meshName string) (model.NodeMap, error) {
+	p := fc.FilePath(meshName, "nodes")
+	log.WithField("path", p).Trace("Looking for nodes...")
+
+	res := make(model.NodeMap)
+
+	entries, err := ioutil.ReadDir(p)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		key := strings.TrimSuffix(entry.Name(), ".json")
+		nodeInfo, err := fc.ReadNode(meshName, key)
+		if err == registry.ErrNodeNotFound {
+			// removed in the meantime
+			continue
+		}
+		if isMalformed(err) {
+			// a tampered entry must not keep all others from being read
+			log.WithError(err).WithField("key", key).Error("Skipping malformed node entry")
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res[key] = nodeInfo
+	}
+
+	return res, nil
+}
+
+// ReadNode reads a single node data file
+func (fc *Context) ReadNode(meshName, key string) (model.NodeInfo, error) {
+	res := model.NodeInfo{}
+
+	body, err := ioutil.ReadFile(fc.FilePath(meshName, "nodes", key+".json"))
+	if os.IsNotExist(err) {
+		return res, registry.ErrNodeNotFound
+	}
+	if err != nil {
+		return res, err
+	}
+
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+// isMalformed checks if err is caused by a file with invalid json
+func isMalformed(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RegisterSigner stores the public signing key of nodeID. The file is created
+// exclusively while holding the mesh lock, so that it cannot be replaced. Returns
+// true if publicKey is registered for nodeID (either by this call or before),
+// false if another key is registered.
+func (fc *Context) RegisterSigner(meshName string, nodeID string, publicKey string) (bool, error) {
+	bRegistered := false
+	err := fc.withLock(meshName, func() error {
+		if err := os.MkdirAll(fc.FilePath(meshName, "signers"), dirMode); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(fc.FilePath(meshName, "signers", nodeID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+		if os.IsExist(err) {
+			body, err := ioutil.ReadFile(fc.FilePath(meshName, "signers", nodeID))
+			if err != nil {
+				return err
+			}
+			log.WithFields(log.Fields{"id": nodeID, "publicKey": string(body)}).Trace("signer already registered")
+			bRegistered = (string(body) == publicKey)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := f.WriteString(publicKey); err != nil {
+			return err
+		}
+		log.WithField("id", nodeID).Debug("Registered signer")
+		bRegistered = true
+		return f.Sync()
+	})
+
+	return bRegistered, err
+}
+
+// ReadSigners reads the public signing keys of all nodes of a mesh
+func (fc *Context) ReadSigners(meshName string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	entries, err := ioutil.ReadDir(fc.FilePath(meshName, "signers"))
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		body, err := ioutil.ReadFile(fc.FilePath(meshName, "signers", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		res[entry.Name()] = string(body)
+	}
+	return res, nil
+}
+
+// DeleteSigner removes the signing key file of nodeID
+func (fc *Context) DeleteSigner(meshName string, nodeID string) error {
+	return removeFile(fc.FilePath(meshName, "signers", nodeID))
+}
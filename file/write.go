@@ -0,0 +1,21 @@
+package file
+
+import (
+	"encoding/json"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// WriteNodeData writes the nodeInfo to the nodes directory of meshName
+func (fc *Context) WriteNodeData(meshName string, nodeInfo model.NodeInfo) error {
+	body, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"data": string(body),
+	}).Trace("writing node file")
+
+	return writeFile(fc.FilePath(meshName, "nodes", nodeInfo.NodeID+".json"), body)
+}
@@ -0,0 +1,259 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrMeshFull is returned when there is no unused address left in a pool
+	ErrMeshFull = errors.New("mesh full: no unused ip address left in mesh network")
+)
+
+const (
+	randomTries = 16
+)
+
+// Pool manages the usable host addresses of a mesh network. The
+// network and broadcast addresses as well as reserved ranges
+// are never handed out.
+type Pool struct {
+	network  *net.IPNet
+	base     *big.Int // first usable address as integer
+	hosts    *big.Int // number of host addresses, without network/broadcast
+	reserved []offsetRange
+}
+
+// offsetRange is an inclusive range of host offsets relative to base
+type offsetRange struct {
+	lo, hi *big.Int
+}
+
+func (r offsetRange) size() *big.Int {
+	s := new(big.Int).Sub(r.hi, r.lo)
+	return s.Add(s, big.NewInt(1))
+}
+
+// NewPool creates an address pool for networkCIDR, excluding all addresses
+// given in reservedRanges. A reserved range may be a single ip, a CIDR or
+// a range in the form of <first ip>-<last ip>.
+func NewPool(networkCIDR string, reservedRanges []string) (*Pool, error) {
+	_, ipnet, err := net.ParseCIDR(networkCIDR)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := ipnet.Mask.Size()
+	hostBits := uint(bits - ones)
+
+	p := &Pool{
+		network: ipnet,
+		base:    ipToInt(ipnet.IP),
+		hosts:   new(big.Int).Lsh(big.NewInt(1), hostBits),
+	}
+	if hostBits >= 2 {
+		// skip network and broadcast address. For ipv6 these are the
+		// subnet-router anycast and the highest address of the network.
+		p.base.Add(p.base, big.NewInt(1))
+		p.hosts.Sub(p.hosts, big.NewInt(2))
+	}
+
+	for _, r := range reservedRanges {
+		first, last, err := ParseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		p.addReserved(first, last)
+	}
+
+	return p, nil
+}
+
+// ParseRange parses a single ip, a CIDR or a range in the form of
+// <first ip>-<last ip> and returns first and last address of it.
+func ParseRange(r string) (net.IP, net.IP, error) {
+	r = strings.TrimSpace(r)
+
+	if strings.Contains(r, "/") {
+		_, ipnet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		last := make(net.IP, len(ipnet.IP))
+		for i := range ipnet.IP {
+			last[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+		}
+		return ipnet.IP, last, nil
+	}
+
+	parts := strings.SplitN(r, "-", 2)
+	first := net.ParseIP(strings.TrimSpace(parts[0]))
+	if first == nil {
+		return nil, nil, fmt.Errorf("invalid ip range: %s", r)
+	}
+	last := first
+	if len(parts) == 2 {
+		last = net.ParseIP(strings.TrimSpace(parts[1]))
+		if last == nil {
+			return nil, nil, fmt.Errorf("invalid ip range: %s", r)
+		}
+	}
+	if ipToInt(first).Cmp(ipToInt(last)) > 0 {
+		return nil, nil, fmt.Errorf("invalid ip range, first address is after last: %s", r)
+	}
+	return first, last, nil
+}
+
+// addReserved clips the range to the pool's host addresses and merges
+// it into the list of reserved offset ranges
+func (p *Pool) addReserved(first, last net.IP) {
+	if len(normalize(first)) != len(normalize(p.network.IP)) {
+		// other address family
+		return
+	}
+	maxOffset := new(big.Int).Sub(p.hosts, big.NewInt(1))
+	lo := new(big.Int).Sub(ipToInt(first), p.base)
+	hi := new(big.Int).Sub(ipToInt(last), p.base)
+	if hi.Sign() < 0 || lo.Cmp(maxOffset) > 0 {
+		// outside of pool
+		return
+	}
+	if lo.Sign() < 0 {
+		lo.SetInt64(0)
+	}
+	if hi.Cmp(maxOffset) > 0 {
+		hi.Set(maxOffset)
+	}
+
+	ranges := append(p.reserved, offsetRange{lo: lo, hi: hi})
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].lo.Cmp(ranges[j].lo) < 0
+	})
+	merged := make([]offsetRange, 0, len(ranges))
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			prev := &merged[len(merged)-1]
+			next := new(big.Int).Add(prev.hi, big.NewInt(1))
+			if r.lo.Cmp(next) <= 0 {
+				if r.hi.Cmp(prev.hi) > 0 {
+					prev.hi = r.hi
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	p.reserved = merged
+}
+
+// Network returns the network of this pool
+func (p *Pool) Network() *net.IPNet {
+	return p.network
+}
+
+// Size returns the number of addresses which can be handed out, that is
+// all host addresses of the network except reserved ones.
+func (p *Pool) Size() *big.Int {
+	s := new(big.Int).Set(p.hosts)
+	for _, r := range p.reserved {
+		s.Sub(s, r.size())
+	}
+	return s
+}
+
+// IsUsable checks if ip may be handed out from this pool
+func (p *Pool) IsUsable(ip net.IP) bool {
+	if ip == nil || !p.network.Contains(ip) {
+		return false
+	}
+	off := new(big.Int).Sub(ipToInt(ip), p.base)
+	if off.Sign() < 0 || off.Cmp(p.hosts) >= 0 {
+		return false
+	}
+	for _, r := range p.reserved {
+		if off.Cmp(r.lo) >= 0 && off.Cmp(r.hi) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RandomFree returns a random usable address of the pool which is not part
+// of used (keyed by ip.String()). Returns ErrMeshFull if all usable
+// addresses are taken.
+func (p *Pool) RandomFree(used map[string]bool) (net.IP, error) {
+	size := p.Size()
+
+	usedInPool := big.NewInt(0)
+	for ipStr := range used {
+		if p.IsUsable(net.ParseIP(ipStr)) {
+			usedInPool.Add(usedInPool, big.NewInt(1))
+		}
+	}
+	if usedInPool.Cmp(size) >= 0 {
+		return nil, ErrMeshFull
+	}
+
+	rnd := rand.New(rand.NewSource(rand.Int63()))
+	for i := 0; i < randomTries; i++ {
+		ip := p.nth(new(big.Int).Rand(rnd, size))
+		if !used[ip.String()] {
+			return ip, nil
+		}
+	}
+
+	// pool is crowded, scan for a free address starting at a random position
+	start := new(big.Int).Rand(rnd, size)
+	idx := new(big.Int).Set(start)
+	for {
+		ip := p.nth(idx)
+		if !used[ip.String()] {
+			return ip, nil
+		}
+		idx.Add(idx, big.NewInt(1))
+		if idx.Cmp(size) >= 0 {
+			idx.SetInt64(0)
+		}
+		if idx.Cmp(start) == 0 {
+			break
+		}
+	}
+
+	return nil, ErrMeshFull
+}
+
+// nth returns the n-th usable (non-reserved) address of the pool
+func (p *Pool) nth(n *big.Int) net.IP {
+	off := new(big.Int).Set(n)
+	for _, r := range p.reserved {
+		if r.lo.Cmp(off) <= 0 {
+			off.Add(off, r.size())
+		} else {
+			break
+		}
+	}
+	return intToIP(off.Add(off, p.base), len(normalize(p.network.IP)))
+}
+
+// normalize returns the 4 byte form of ipv4 addresses
+func normalize(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(normalize(ip))
+}
+
+func intToIP(i *big.Int, size int) net.IP {
+	b := i.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
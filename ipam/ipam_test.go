@@ -0,0 +1,205 @@
+package ipam
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestNewPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		cidr      string
+		reserved  []string
+		wantErr   bool
+		wantSize  string
+		wantFirst string
+		wantLast  string
+	}{
+		{"ipv4 /30", "10.0.0.0/30", nil, false, "2", "10.0.0.1", "10.0.0.2"},
+		{"ipv4 /29", "10.0.0.0/29", nil, false, "6", "10.0.0.1", "10.0.0.6"},
+		{"ipv4 /31 has no network and broadcast", "10.0.0.0/31", nil, false, "2", "10.0.0.0", "10.0.0.1"},
+		{"ipv4 /32", "10.0.0.5/32", nil, false, "1", "10.0.0.5", "10.0.0.5"},
+		{"host bits are ignored", "10.0.0.9/29", nil, false, "6", "10.0.0.9", "10.0.0.14"},
+		{"reserved range", "10.0.0.0/28", []string{"10.0.0.1-10.0.0.4"}, false, "10", "10.0.0.5", "10.0.0.14"},
+		{"reserved at the end", "10.0.0.0/28", []string{"10.0.0.12/30"}, false, "11", "10.0.0.1", "10.0.0.11"},
+		{"reserved ranges are merged", "10.0.0.0/28", []string{"10.0.0.2", "10.0.0.0/30", "10.0.0.3-10.0.0.6"}, false, "8", "10.0.0.7", "10.0.0.14"},
+		{"reserved network and broadcast", "10.0.0.0/28", []string{"10.0.0.0", "10.0.0.15"}, false, "14", "10.0.0.1", "10.0.0.14"},
+		{"reserved outside of pool", "10.0.0.0/28", []string{"192.168.0.1", "10.0.1.0/24", "fd00::1"}, false, "14", "10.0.0.1", "10.0.0.14"},
+		{"ipv6 /126", "fd00::/126", nil, false, "2", "fd00::1", "fd00::2"},
+		{"ipv6 /127", "fd00::/127", nil, false, "2", "fd00::", "fd00::1"},
+		{"ipv6 /128", "fd00::7/128", nil, false, "1", "fd00::7", "fd00::7"},
+		{"ipv6 /64", "fd00::/64", []string{"fd00::1-fd00::ff"}, false, "18446744073709551359", "fd00::100", "fd00::ffff:ffff:ffff:fffe"},
+		{"invalid cidr", "10.0.0.0/33", nil, true, "", "", ""},
+		{"invalid reserved range", "10.0.0.0/28", []string{"10.0.0.x"}, true, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPool(tt.cidr, tt.reserved)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			size := p.Size()
+			if size.String() != tt.wantSize {
+				t.Errorf("size is %s, want %s", size, tt.wantSize)
+			}
+			if first := p.nth(big.NewInt(0)); first.String() != tt.wantFirst {
+				t.Errorf("first address is %s, want %s", first, tt.wantFirst)
+			}
+			last := p.nth(new(big.Int).Sub(size, big.NewInt(1)))
+			if last.String() != tt.wantLast {
+				t.Errorf("last address is %s, want %s", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		r         string
+		wantErr   bool
+		wantFirst string
+		wantLast  string
+	}{
+		{"single ip", "10.0.0.1", false, "10.0.0.1", "10.0.0.1"},
+		{"cidr", "10.0.0.4/30", false, "10.0.0.4", "10.0.0.7"},
+		{"cidr with host bits", "10.0.0.5/30", false, "10.0.0.4", "10.0.0.7"},
+		{"range", "10.0.0.1-10.0.0.9", false, "10.0.0.1", "10.0.0.9"},
+		{"range with spaces", " 10.0.0.1 - 10.0.0.9 ", false, "10.0.0.1", "10.0.0.9"},
+		{"range of one ip", "10.0.0.3-10.0.0.3", false, "10.0.0.3", "10.0.0.3"},
+		{"ipv6 cidr", "fd00::/120", false, "fd00::", "fd00::ff"},
+		{"ipv6 range", "fd00::1-fd00::10", false, "fd00::1", "fd00::10"},
+		{"reversed range", "10.0.0.9-10.0.0.1", true, "", ""},
+		{"invalid ip", "10.0.0.256", true, "", ""},
+		{"invalid last ip", "10.0.0.1-x", true, "", ""},
+		{"invalid cidr", "10.0.0.0/40", true, "", ""},
+		{"empty", "", true, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last, err := ParseRange(tt.r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s-%s", first, last)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if first.String() != tt.wantFirst || last.String() != tt.wantLast {
+				t.Errorf("got %s-%s, want %s-%s", first, last, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestNth(t *testing.T) {
+	p, err := NewPool("10.0.0.0/28", []string{"10.0.0.3-10.0.0.4", "10.0.0.8"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "10.0.0.1"},
+		{1, "10.0.0.2"},
+		{2, "10.0.0.5"},
+		{4, "10.0.0.7"},
+		{5, "10.0.0.9"},
+		{10, "10.0.0.14"},
+	}
+
+	for _, tt := range tests {
+		if got := p.nth(big.NewInt(tt.n)); got.String() != tt.want {
+			t.Errorf("nth(%d) is %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestRandomFree(t *testing.T) {
+	tests := []struct {
+		name     string
+		cidr     string
+		reserved []string
+		used     []string
+		wantErr  error
+		want     string
+	}{
+		{"full pool", "10.0.0.0/30", nil, []string{"10.0.0.1", "10.0.0.2"}, ErrMeshFull, ""},
+		{"full by reservations", "10.0.0.0/30", []string{"10.0.0.0/30"}, nil, ErrMeshFull, ""},
+		{"full by reservations and use", "10.0.0.0/29", []string{"10.0.0.1-10.0.0.4"}, []string{"10.0.0.5", "10.0.0.6"}, ErrMeshFull, ""},
+		{"last free address", "10.0.0.0/28", nil, []string{
+			"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7",
+			"10.0.0.8", "10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.13", "10.0.0.14",
+		}, nil, "10.0.0.9"},
+		{"last free address besides reservation", "10.0.0.0/29", []string{"10.0.0.2"}, []string{"10.0.0.1", "10.0.0.3", "10.0.0.5", "10.0.0.6"}, nil, "10.0.0.4"},
+		{"used addresses outside of pool are ignored", "10.0.0.0/30", nil, []string{"10.0.0.1", "10.0.0.3", "192.168.0.1"}, nil, "10.0.0.2"},
+		{"ipv4 /31", "10.0.0.0/31", nil, []string{"10.0.0.0"}, nil, "10.0.0.1"},
+		{"ipv4 /32", "10.0.0.5/32", nil, nil, nil, "10.0.0.5"},
+		{"ipv4 /32 used", "10.0.0.5/32", nil, []string{"10.0.0.5"}, ErrMeshFull, ""},
+		{"ipv6 /127", "fd00::/127", nil, []string{"fd00::"}, nil, "fd00::1"},
+		{"ipv6 /126 full", "fd00::/126", nil, []string{"fd00::1", "fd00::2"}, ErrMeshFull, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPool(tt.cidr, tt.reserved)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			used := make(map[string]bool)
+			for _, ip := range tt.used {
+				used[ip] = true
+			}
+
+			// several rounds, as the result is random
+			for i := 0; i < 20; i++ {
+				ip, err := p.RandomFree(used)
+				if err != tt.wantErr {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr == nil && ip.String() != tt.want {
+					t.Fatalf("got %s, want %s", ip, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomFreeIsUsable(t *testing.T) {
+	p, err := NewPool("10.0.0.0/27", []string{"10.0.0.1-10.0.0.8", "10.0.0.20/30"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	used := make(map[string]bool)
+	for i := int64(0); i < p.Size().Int64(); i++ {
+		ip, err := p.RandomFree(used)
+		if err != nil {
+			t.Fatalf("unexpected error after %d addresses: %s", i, err)
+		}
+		if !p.IsUsable(ip) {
+			t.Fatalf("%s is not usable", ip)
+		}
+		if used[ip.String()] {
+			t.Fatalf("%s is handed out twice", ip)
+		}
+		used[ip.String()] = true
+	}
+
+	if _, err := p.RandomFree(used); err != ErrMeshFull {
+		t.Errorf("got error %v, want %v", err, ErrMeshFull)
+	}
+}
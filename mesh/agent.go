@@ -0,0 +1,167 @@
+package mesh
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+// AgentRequest includes all data necessary to run the agent
+type AgentRequest struct {
+	MeshName        string
+	NodeID          string
+	Interval        time.Duration
+	MaxBackoff      time.Duration
+	LeaveOnShutdown bool
+	// KeyRotation is the interval in which the agent rotates the
+	// wireguard key of the node. 0 disables rotation.
+	KeyRotation time.Duration
+	// KeyRotationGrace is the time peers have to install a new key before
+	// the rotation is cancelled. 0 uses DefaultKeyRotationGrace, but at
+	// least three intervals.
+	KeyRotationGrace time.Duration
+	// Signals delivers SIGHUP to trigger an immediate reconciliation
+	// and SIGTERM/SIGINT to shut down the agent.
+	Signals <-chan os.Signal
+}
+
+// Agent keeps the wireguard interface of a joined mesh in line with the node
+// list until it receives SIGTERM or SIGINT. Errors accessing the registry do not end
+// the agent, instead it retries with an exponential backoff.
+func (mc *Context) Agent(req *AgentRequest) error {
+	log.WithField("req", *req).Trace("Agent.param")
+
+	var (
+		meshInfo *model.MeshInfo
+		wgi      *wg.WireguardInterface
+		err      error
+	)
+	wait := time.After(0)
+	backoff := req.Interval
+	started := time.Now()
+
+	// cancelWait ends a pending wait for node changes, so that it does
+	// not outlive a signal or the agent.
+	cancelWait := func() {}
+	defer func() { cancelWait() }()
+
+	for {
+		select {
+		case sig := <-req.Signals:
+			switch sig {
+			case syscall.SIGHUP:
+				log.Info("Received SIGHUP, reloading mesh data")
+				meshInfo, wgi = nil, nil
+				backoff = req.Interval
+			default:
+				log.WithField("signal", sig).Info("Shutting down agent")
+				return mc.shutdownAgent(req, meshInfo)
+			}
+		case <-wait:
+		}
+		cancelWait()
+
+		err = nil
+		if meshInfo == nil {
+			meshInfo, err = mc.ReadMeetingPoint(req.MeshName)
+			if err == nil && meshInfo == nil {
+				// no meeting point is not recoverable
+				return errNoMeetingPoint
+			}
+		}
+		if err == nil && wgi == nil {
+			wgi, err = setupWireguardForMesh(meshInfo)
+			if err != nil {
+				wgi = nil
+			}
+		}
+		var next time.Time
+		if err == nil {
+			next, err = mc.reconcile(wgi, meshInfo, req.MeshName, req.NodeID)
+		}
+		if err == nil && req.KeyRotation > 0 {
+			var bAnnounced bool
+			bAnnounced, err = mc.rotateKeyIfDue(req, started)
+			if bAnnounced {
+				next = time.Now().Add(keyRotationPollInterval)
+			}
+		}
+
+		if err != nil {
+			wait = time.After(backoff)
+			log.WithError(err).WithField("retryIn", backoff).Warn("Unable to update mesh, backing off")
+
+			backoff *= 2
+			if backoff > req.MaxBackoff {
+				backoff = req.MaxBackoff
+			}
+			continue
+		}
+
+		log.WithField("nextIn", req.Interval).Trace("Agent.reconciled")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelWait = cancel
+		wait = mc.nodeChanges(ctx, req.MeshName, untilNextCheck(req.Interval, next))
+		backoff = req.Interval
+	}
+}
+
+// rotateKeyIfDue announces a new key for the node if its current key is
+// older than req.KeyRotation. Unless req.KeyRotationGrace is set, peers get
+// at least three intervals to install the new key. Returns true if a
+// key has been announced.
+func (mc *Context) rotateKeyIfDue(req *AgentRequest, since time.Time) (bool, error) {
+	self, err := mc.ReadNode(req.MeshName, req.NodeID)
+	if err != nil {
+		return false, err
+	}
+	if !keyRotationDue(self, req.KeyRotation, since, time.Now()) {
+		return false, nil
+	}
+
+	grace := req.KeyRotationGrace
+	if grace <= 0 {
+		grace = DefaultKeyRotationGrace
+		if grace < 3*req.Interval {
+			grace = 3 * req.Interval
+		}
+	}
+	pubkey, deadline, err := mc.announceKey(req.MeshName, req.NodeID, grace)
+	if err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{
+		"pubkey": pubkey,
+		"until":  deadline.Local(),
+	}).Info("Announced new key")
+
+	return true, nil
+}
+
+func (mc *Context) shutdownAgent(req *AgentRequest, meshInfo *model.MeshInfo) error {
+	if !req.LeaveOnShutdown {
+		return nil
+	}
+	if meshInfo == nil {
+		var err error
+		meshInfo, err = mc.ReadMeetingPoint(req.MeshName)
+		if err != nil {
+			return err
+		}
+		if meshInfo == nil {
+			return errNoMeetingPoint
+		}
+	}
+
+	log.WithField("mesh", req.MeshName).Info("Leaving mesh on shutdown")
+	return mc.Leave(&LeaveRequest{
+		MeshName: req.MeshName,
+		MeshInfo: meshInfo,
+		NodeID:   req.NodeID,
+	})
+}
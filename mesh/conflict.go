@@ -0,0 +1,80 @@
+package mesh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+)
+
+const (
+	// number of new keys Join tries when its key is used by another node
+	maxKeyConflictAttempts = 3
+)
+
+// ConflictError is returned by Join if the joining node shares a wireguard
+// public key with other nodes of the mesh, which cannot be resolved by taking
+// a new key and must be resolved manually, e.g. by removing one of them.
+type ConflictError struct {
+	// Conflicts maps each public key used by more than one node
+	// to the sorted ids of these nodes
+	Conflicts map[string][]string
+}
+
+func (e *ConflictError) Error() string {
+	pubkeys := make([]string, 0, len(e.Conflicts))
+	for pubkey := range e.Conflicts {
+		pubkeys = append(pubkeys, pubkey)
+	}
+	sort.Strings(pubkeys)
+
+	groups := make([]string, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		groups = append(groups, strings.Join(e.Conflicts[pubkey], ", "))
+	}
+	return fmt.Sprintf("nodes share a wireguard public key: %s", strings.Join(groups, "; "))
+}
+
+// involves checks if nodeID is part of any conflict
+func (e *ConflictError) involves(nodeID string) bool {
+	for _, nodeIDs := range e.Conflicts {
+		if containsNodeID(nodeIDs, nodeID) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNodeID(nodeIDs []string, nodeID string) bool {
+	for _, id := range nodeIDs {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// keyConflicts looks for nodes with the same public key. Returns nil
+// if all public keys are unique.
+func keyConflicts(nodes model.NodeMap) *ConflictError {
+	dupeMapByPubkey := make(map[string][]string)
+	for nodeKey, nodeData := range nodes {
+		dupeMapByPubkey[nodeData.WireguardPublicKey] = append(dupeMapByPubkey[nodeData.WireguardPublicKey], nodeKey)
+	}
+
+	res := &ConflictError{
+		Conflicts: make(map[string][]string),
+	}
+	for pubkey, nodeIDs := range dupeMapByPubkey {
+		if len(nodeIDs) < 2 {
+			continue
+		}
+		sort.Strings(nodeIDs)
+		res.Conflicts[pubkey] = nodeIDs
+	}
+	if len(res.Conflicts) == 0 {
+		return nil
+	}
+	return res
+}
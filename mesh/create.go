@@ -0,0 +1,34 @@
+package mesh
+
+import (
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+)
+
+// CreateRequest includes all data necessary to create a mesh
+type CreateRequest struct {
+	MeshName       string
+	NetworkCIDR    string
+	NetworkCIDR6   string
+	ReservedRanges []string
+	NodeTTL        int
+	Namespace      string
+	TransitKey     string
+	PresharedKeys  bool
+	PSKRotation    int
+}
+
+// Create creates the meeting point for a new mesh. Returns false if
+// the mesh is already present.
+func (mc *Context) Create(req *CreateRequest) (bool, error) {
+	return mc.CreateMeetingPoint(model.MeshInfo{
+		Name:           req.MeshName,
+		NetworkCIDR:    req.NetworkCIDR,
+		NetworkCIDR6:   req.NetworkCIDR6,
+		ReservedRanges: req.ReservedRanges,
+		NodeTTL:        req.NodeTTL,
+		Namespace:      req.Namespace,
+		TransitKey:     req.TransitKey,
+		PresharedKeys:  req.PresharedKeys,
+		PSKRotation:    req.PSKRotation,
+	})
+}
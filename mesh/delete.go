@@ -0,0 +1,102 @@
+package mesh
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Delete removes a mesh with all its node data and ip reservations
+func (mc *Context) Delete(name string) (bool, error) {
+	mi, err := mc.ReadMeetingPoint(name)
+	if err != nil {
+		log.WithError(err).Error("Error reading meeting point")
+		return false, err
+	}
+	if mi == nil {
+		log.Debug("No meeting point for named mesh")
+		return false, nil
+	}
+
+	nodes, err := mc.ReadNodes(name)
+	if err != nil {
+		log.WithError(err).Error("Error reading node list")
+		return false, err
+	}
+	log.WithField("nodes", nodes).Debugf("Found %d nodes", len(nodes))
+
+	for nodeKey := range nodes {
+		if err := mc.RemoveNode(name, nodeKey); err != nil {
+			log.WithError(err).Error("Unable to delete node")
+			return false, err
+		}
+	}
+
+	// delete remaining ip reservations
+	ips, err := mc.ReadIPs(name)
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		if err := mc.ReleaseIP(name, ip); err != nil {
+			log.WithError(err).Error("Unable to release ip")
+			return false, err
+		}
+	}
+
+	// delete remaining signers
+	signers, err := mc.ReadSigners(name)
+	if err != nil {
+		return false, err
+	}
+	for nodeID := range signers {
+		if err := mc.DeleteSigner(name, nodeID); err != nil {
+			log.WithError(err).Error("Unable to delete signer")
+			return false, err
+		}
+	}
+
+	return mc.DeleteMeetingPoint(name)
+}
+
+// RemoveNode deletes the node entry indicated by nodeID and meshName
+// and releases the ip reservations, the signer and the preshared keys of the node.
+// Reservations which cannot be released, e.g. because the node's policy only
+// allows to create them, are left to prune.
+func (mc *Context) RemoveNode(meshName string, nodeID string) error {
+	nodeInfo, err := mc.ReadNode(meshName, nodeID)
+	if err != nil {
+		log.WithError(err).Debug("Unable to read node data before deleting")
+	}
+
+	if err := mc.DeleteNode(meshName, nodeID); err != nil {
+		return err
+	}
+	if err := mc.DeleteSigner(meshName, nodeID); err != nil {
+		return err
+	}
+	// the signer must be registered again when rejoining
+	delete(mc.signingKeys, meshName)
+	if err := mc.removePSKs(meshName, nodeID); err != nil {
+		return err
+	}
+	if err := mc.removeStoredPrivateKey(meshName, nodeID); err != nil {
+		return err
+	}
+
+	if nodeInfo.WireguardIP == "" {
+		return nil
+	}
+	for _, ip := range nodeInfo.WireguardIPs() {
+		owner, err := mc.ReadIPOwner(meshName, ip)
+		if err != nil {
+			return err
+		}
+		if owner != nodeID {
+			// not ours (any more), leave it alone
+			continue
+		}
+		if err := mc.ReleaseIP(meshName, ip); err != nil {
+			log.WithError(err).WithField("ip", ip).Warn("Unable to release ip reservation, leaving it to prune")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package mesh
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/ipam"
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+// JoinRequest includes all data necessary to execute the join
+type JoinRequest struct {
+	MeshName   string
+	NodeID     string
+	MeshInfo   *model.MeshInfo
+	EndpointIP string
+	ListenPort int
+	// WireguardImpl is one of wg.ImplKernel, wg.ImplUserspace, wg.ImplAuto
+	WireguardImpl string
+	// Force replaces the registered public key of the node with the local
+	// one if they do not match
+	Force bool
+}
+
+const (
+	maxIPAllocationAttempts = 32
+)
+
+// allocateIP chooses a random ip from networkCIDR which is not used by
+// any of the given nodes and reserves it for req.NodeID. Retries with another
+// ip if some other node reserved the chosen one in the meantime. Returns
+// ipam.ErrMeshFull if there is no unused ip left.
+func (mc *Context) allocateIP(req *JoinRequest, networkCIDR string, nodes model.NodeMap) (net.IP, error) {
+	pool, err := ipam.NewPool(networkCIDR, req.MeshInfo.ReservedRanges)
+	if err != nil {
+		log.WithError(err).Trace("network cidr or reserved ranges not valid")
+		return nil, err
+	}
+	log.WithField("size", pool.Size()).Trace("allocateIP.dump")
+
+	used := make(map[string]bool)
+	for _, nodeData := range nodes {
+		for _, ip := range nodeData.WireguardIPs() {
+			used[ip] = true
+		}
+	}
+	ips, err := mc.ReadIPs(req.MeshName)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		used[ip] = true
+	}
+
+	for i := 0; i < maxIPAllocationAttempts; i++ {
+		ip, err := pool.RandomFree(used)
+		if err != nil {
+			return nil, err
+		}
+
+		bReserved, err := mc.ReserveIP(req.MeshName, ip.String(), req.NodeID)
+		if err != nil {
+			log.WithError(err).Error("Error reserving ip")
+			return nil, err
+		}
+		if bReserved {
+			return ip, nil
+		}
+		log.WithField("ip", ip).Debug("ip reserved by another node, retrying")
+		used[ip.String()] = true
+	}
+
+	return nil, fmt.Errorf("unable to allocate an unused ip address in mesh network after %d attempts", maxIPAllocationAttempts)
+}
+
+// releaseIPs releases reservations of ips after a failed join
+func (mc *Context) releaseIPs(meshName string, ips []net.IP) {
+	for _, ip := range ips {
+		if err := mc.ReleaseIP(meshName, ip.String()); err != nil {
+			log.WithError(err).Warn("Unable to release ip reservation")
+		}
+	}
+}
+
+// Join takes data from the JoinRequest to join the mesh
+func (mc *Context) Join(req *JoinRequest) error {
+	log.WithField("req", *req).Trace("Join.param")
+
+	// read all nodes from the registry for this mesh network
+	nodes, err := mc.ReadNodes(req.MeshName)
+	if err != nil {
+		log.WithError(err).Error("Error reading node list")
+		return err
+	}
+	log.WithField("nodes", nodes).Debugf("Found %d nodes", len(nodes))
+
+	// ensure we have a wireguard interface w/ key
+	wgi, err := mc.setupWireguard(req)
+	if err != nil {
+		log.WithError(err).Error("Unable to set up wireguard interface")
+		return err
+	}
+
+	// add ourselves to the node list. If our public key turns out to be
+	// used by another node, take a new key and try again.
+	for attempt := 1; ; attempt++ {
+		bAdded, err := mc.registerSelf(req, wgi, nodes)
+		if err != nil {
+			return err
+		}
+
+		// query all nodes with valid signatures. Check for duplicates on same public key...
+		nodes, err = mc.ReadNodes(req.MeshName)
+		if err != nil {
+			log.WithError(err).Error("Error reading node list")
+			return err
+		}
+		nodes, err = mc.verifyNodes(req.MeshName, nodes)
+		if err != nil {
+			log.WithError(err).Error("Error reading signers")
+			return err
+		}
+		conflictErr := keyConflicts(nodes)
+		if conflictErr == nil {
+			break
+		}
+		if !conflictErr.involves(req.NodeID) {
+			// conflicts among other nodes do not affect our own entry,
+			// they have to be resolved manually.
+			log.WithField("conflicts", conflictErr.Conflicts).Warn("Other nodes share a public key, continuing")
+			break
+		}
+		log.WithField("conflicts", conflictErr.Conflicts).Error("Conflict detected")
+
+		if !bAdded {
+			// our existing entry is part of a conflict, which
+			// must be resolved manually.
+			return conflictErr
+		}
+
+		// we added ourselves above, but that's not ok, since we found
+		// a dupe. Remove myself.
+		log.WithField("id", req.NodeID).Warn("Removing myself from node list")
+		if err := mc.RemoveNode(req.MeshName, req.NodeID); err != nil {
+			log.WithError(err).Error("Unable to remove myself after conflict")
+			return err
+		}
+		if attempt >= maxKeyConflictAttempts {
+			return conflictErr
+		}
+
+		privateKey, _, err := wg.GenerateKeyPair()
+		if err != nil {
+			return err
+		}
+		if err := wgi.SetPrivateKey(privateKey); err != nil {
+			return err
+		}
+		nodes, err = mc.ReadNodes(req.MeshName)
+		if err != nil {
+			log.WithError(err).Error("Error reading node list")
+			return err
+		}
+	}
+
+	// at this point, we have a local wg interface with a public key
+	// that's uniquely present in the nodelist.
+	// - Keep its private key, so it survives a reboot
+	if err = mc.persistPrivateKey(wgi, req.MeshName, req.NodeID); err != nil {
+		log.WithError(err).Error("Unable to store private key")
+		return err
+	}
+	// - Assign the overlay IP address to the interface
+	log.WithField("wgi", wgi).Trace("Join.dump")
+	if err = wgi.EnsureIPAddressIsAssigned(); err != nil {
+		return err
+	}
+	// - Add our external IP to the nodelist so others can connect.
+	if err = mc.UpdateEndpoint(req.MeshName, req.NodeID, req.EndpointIP, wgi.ListenPort); err != nil {
+		return err
+	}
+
+	// connect to all others with valid signatures, except expired ones
+	now := time.Now()
+	for nodeKey, nodeData := range req.MeshInfo.ActiveNodes(nodes, now) {
+		if nodeKey == req.NodeID {
+			// this is us.
+			continue
+		}
+
+		psk, _, err := mc.peerPSK(req.MeshInfo, req.MeshName, req.NodeID, nodeKey)
+		if err != nil {
+			log.WithError(err).WithField("peer", nodeKey).Error("Unable to get preshared key for peer, skipping")
+			continue
+		}
+
+		allowedIP := wg.HostNets(nodeData.WireguardIPs())
+		bAdded, err := wgi.AddPeer(nodeData.ExternalIP, nodeData.ListenPort, nodeData.WireguardPublicKey, allowedIP, psk)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"data": nodeData,
+			}).Error("Error adding wireguard peer")
+		}
+		if bAdded {
+			log.WithField("othernode", nodeData).Debug("Added wg peer")
+		}
+	}
+
+	// 2nd stage: iterate through all peers of wg interface, remove
+	// those that are not in nodelist.
+
+	// interface and route handling
+	if err := wgi.EnsureInterfaceIsUp(); err != nil {
+		log.WithError(err).Error("Unable to up wg interface")
+		return err
+	}
+	log.WithField("dev", wgi.InterfaceName).Debug("Device up")
+	for _, networkCIDR := range req.MeshInfo.Networks() {
+		if err := wgi.EnsureRouteIsSet(networkCIDR); err != nil {
+			log.WithError(err).Error("Unable to set route")
+			return err
+		}
+	}
+	log.WithField("dev", wgi.InterfaceName).Debug("Route set")
+
+	return nil
+}
+
+// registerSelf adds req.NodeID to the node list using the public key of wgi,
+// or checks the existing entry. Returns true if the node has been added.
+func (mc *Context) registerSelf(req *JoinRequest, wgi *wg.WireguardInterface, nodes model.NodeMap) (bool, error) {
+	// check if we're already present in the list of nodes
+	nodeData, ex := nodes[req.NodeID]
+	// if not, put ourself into it
+	if !ex {
+		// choose random ips that no one else holds and reserve them,
+		// one for each network of the mesh
+		ips := make([]net.IP, 0, 2)
+		for _, networkCIDR := range req.MeshInfo.Networks() {
+			ip, err := mc.allocateIP(req, networkCIDR, nodes)
+			if err != nil {
+				mc.releaseIPs(req.MeshName, ips)
+				return false, err
+			}
+			ips = append(ips, ip)
+		}
+
+		nodeInfo := model.NodeInfo{
+			NodeID:             req.NodeID,
+			WireguardIP:        ips[0].String(),
+			WireguardPublicKey: wgi.PublicKey,
+			ExternalIP:         "",
+			ListenPort:         req.ListenPort,
+			LastSeen:           time.Now(),
+		}
+		wgi.IP = ips[0]
+		if len(ips) > 1 {
+			nodeInfo.WireguardIP6 = ips[1].String()
+			wgi.IP6 = ips[1]
+		}
+
+		// add ourself to nodes list, but without the external
+		// ip, so no one can connect (yet)
+		err := mc.writeNodeData(req.MeshName, nodeInfo)
+		if err != nil {
+			log.WithError(err).Error("Error writing node data")
+			mc.releaseIPs(req.MeshName, ips)
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	log.WithField("nodeData", nodeData).Debug("Found myself in node list.")
+
+	// our key must be the registered one, or the announced one
+	// if a key rotation has been interrupted
+	if wgi.PublicKey != nodeData.WireguardPublicKey && wgi.PublicKey != nodeData.NextPublicKey {
+		log.WithFields(log.Fields{
+			"local":      wgi.PublicKey,
+			"registered": nodeData.WireguardPublicKey,
+		}).Warn("Local public key does not match registered one")
+		if !req.Force {
+			return false, ErrKeyMismatch
+		}
+
+		nodeData.WireguardPublicKey = wgi.PublicKey
+		nodeData.NextPublicKey = ""
+		if err := mc.writeNodeData(req.MeshName, nodeData); err != nil {
+			log.WithError(err).Error("Error writing node data")
+			return false, err
+		}
+		log.WithField("pubkey", wgi.PublicKey).Info("Replaced registered public key")
+	}
+
+	// make sure our ips are reserved for us, nodes may have joined
+	// before ip reservations were in place.
+	for _, ip := range nodeData.WireguardIPs() {
+		bReserved, err := mc.ReserveIP(req.MeshName, ip, req.NodeID)
+		if err != nil {
+			log.WithError(err).Error("Error reserving ip")
+			return false, err
+		}
+		if !bReserved {
+			return false, fmt.Errorf("ip %s of this node is reserved by another node", ip)
+		}
+	}
+
+	wgi.IP = net.ParseIP(nodeData.WireguardIP)
+	if nodeData.WireguardIP6 != "" {
+		wgi.IP6 = net.ParseIP(nodeData.WireguardIP6)
+	}
+
+	return false, nil
+}
+
+func (mc *Context) setupWireguard(req *JoinRequest) (*wg.WireguardInterface, error) {
+	wgi := &wg.WireguardInterface{
+		InterfaceName:   fmt.Sprintf("wg-%s", req.MeshInfo.Name),
+		ListenPort:      req.ListenPort,
+		Implementation:  req.WireguardImpl,
+		UserspaceBinary: config.Config().WireguardGoPath,
+	}
+	ex, err := wgi.HasInterface()
+	if err != nil || ex == false {
+		// create interface
+		if err = wgi.AddInterface(); err != nil {
+			log.WithError(err).Error("Cannot create wireguard interface")
+			return wgi, err
+		}
+
+	}
+
+	// a new interface has no key, use the stored one if we have one
+	if err = mc.restorePrivateKey(wgi, req.MeshName, req.NodeID); err != nil {
+		log.WithError(err).Error("Unable to restore private key")
+		return wgi, err
+	}
+
+	err = wgi.SetupInterfaceWithConfig()
+
+	return wgi, err
+
+}
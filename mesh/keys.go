@@ -0,0 +1,138 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+// Places to keep the wireguard private key of a node (WGVAM_KEY_STORE)
+const (
+	// KeyStoreFile keeps the key in a file in the key directory
+	KeyStoreFile = "file"
+	// KeyStoreVault keeps the key in vault, readable only by the node itself
+	KeyStoreVault = "vault"
+)
+
+var (
+	// ErrKeyMismatch is returned by Join if the local wireguard key is
+	// not the one registered for the node
+	ErrKeyMismatch = errors.New("local wireguard key does not match the key registered for this node")
+)
+
+// privateKeyFile returns the path of the file holding this node's
+// wireguard private key for meshName
+func privateKeyFile(meshName string) string {
+	return filepath.Join(config.Config().KeyDir, meshName, "wg.key")
+}
+
+// keyStore returns the registry if wireguard private keys are kept there
+func (mc *Context) keyStore() (registry.KeyStore, error) {
+	ks, ok := mc.Registry.(registry.KeyStore)
+	if !ok {
+		return nil, fmt.Errorf("key store %s needs the vault backend", KeyStoreVault)
+	}
+	return ks, nil
+}
+
+// loadPrivateKey reads the stored wireguard private key of nodeID.
+// Returns "" if there is none.
+func (mc *Context) loadPrivateKey(meshName string, nodeID string) (string, error) {
+	switch config.Config().KeyStore {
+	case KeyStoreFile:
+		body, err := ioutil.ReadFile(privateKeyFile(meshName))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	case KeyStoreVault:
+		ks, err := mc.keyStore()
+		if err != nil {
+			return "", err
+		}
+		return ks.ReadPrivateKey(meshName, nodeID)
+	}
+	return "", fmt.Errorf("unknown key store: %s", config.Config().KeyStore)
+}
+
+// storePrivateKey keeps the wireguard private key of nodeID
+func (mc *Context) storePrivateKey(meshName string, nodeID string, privateKey string) error {
+	switch config.Config().KeyStore {
+	case KeyStoreFile:
+		p := privateKeyFile(meshName)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(p, []byte(privateKey+"\n"), 0600)
+	case KeyStoreVault:
+		ks, err := mc.keyStore()
+		if err != nil {
+			return err
+		}
+		return ks.WritePrivateKey(meshName, nodeID, privateKey)
+	}
+	return fmt.Errorf("unknown key store: %s", config.Config().KeyStore)
+}
+
+// restorePrivateKey sets the stored private key on wgi, if the interface
+// has no key yet, e.g. because it has been created again after a reboot
+func (mc *Context) restorePrivateKey(wgi *wg.WireguardInterface, meshName string, nodeID string) error {
+	stored, err := mc.loadPrivateKey(meshName, nodeID)
+	if err != nil || stored == "" {
+		return err
+	}
+	current, err := wgi.PrivateKey()
+	if err != nil || current != "" {
+		return err
+	}
+	log.WithField("store", config.Config().KeyStore).Debug("Restoring private key")
+	return wgi.SetPrivateKey(stored)
+}
+
+// persistPrivateKey stores the private key of wgi, if it is not
+// stored already
+func (mc *Context) persistPrivateKey(wgi *wg.WireguardInterface, meshName string, nodeID string) error {
+	current, err := wgi.PrivateKey()
+	if err != nil {
+		return err
+	}
+	stored, err := mc.loadPrivateKey(meshName, nodeID)
+	if err != nil {
+		return err
+	}
+	if current == "" || current == stored {
+		return nil
+	}
+	log.WithField("store", config.Config().KeyStore).Debug("Storing private key")
+	return mc.storePrivateKey(meshName, nodeID, current)
+}
+
+// removePrivateKeyFile deletes the private key file of meshName, if any
+func removePrivateKeyFile(meshName string) error {
+	err := os.Remove(privateKeyFile(meshName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeStoredPrivateKey deletes the private key of nodeID, if the
+// registry stores them
+func (mc *Context) removeStoredPrivateKey(meshName string, nodeID string) error {
+	ks, ok := mc.Registry.(registry.KeyStore)
+	if !ok {
+		return nil
+	}
+	return ks.DeletePrivateKey(meshName, nodeID)
+}
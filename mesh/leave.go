@@ -1,4 +1,4 @@
-package vault
+package mesh
 
 import (
 	"errors"
@@ -18,7 +18,7 @@ type LeaveRequest struct {
 }
 
 // Leave takes data from the LeaveRequest to leave the mesh
-func (vc *Context) Leave(req *LeaveRequest) error {
+func (mc *Context) Leave(req *LeaveRequest) error {
 	log.WithField("req", *req).Trace("Leave.param")
 
 	wgi := &wg.WireguardInterface{
@@ -36,12 +36,16 @@ func (vc *Context) Leave(req *LeaveRequest) error {
 	}
 
 	// remove myself from nodelist
-	err = vc.DeleteNode(req.MeshName, req.NodeID)
+	err = mc.RemoveNode(req.MeshName, req.NodeID)
 	if err != nil {
-		log.WithError(err).Trace("Unable to delete data from vault")
+		log.WithError(err).Trace("Unable to delete node data")
 		return err
 	}
 
+	if err = removePrivateKeyFile(req.MeshName); err != nil {
+		log.WithError(err).Warn("Unable to remove private key file")
+	}
+
 	// remove wireguard interface and all peers
 	err = wgi.RemoveAllWgPeers()
 	if err != nil {
@@ -0,0 +1,65 @@
+package mesh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errNoMeetingPoint = errors.New("no meeting point data found for given network name")
+)
+
+// Context binds all mesh operations to a registry backend, which
+// stores meeting points and node entries
+type Context struct {
+	registry.Registry
+
+	// signing keys of this node, by mesh
+	signingKeys map[string]ed25519.PrivateKey
+
+	// unsigned node entries which have been warned about, by mesh and node id
+	unsignedWarned map[string]bool
+}
+
+// New returns a Context using reg as the backend
+func New(reg registry.Registry) *Context {
+	return &Context{
+		Registry:       reg,
+		signingKeys:    make(map[string]ed25519.PrivateKey),
+		unsignedWarned: make(map[string]bool),
+	}
+}
+
+// nodeChanges returns a channel which receives when node entries of meshName
+// changed or d has passed. Registries which are not able to watch for changes
+// are polled, i.e. the channel receives after d. Cancelling ctx ends a
+// pending wait, the channel does not receive then.
+func (mc *Context) nodeChanges(ctx context.Context, meshName string, d time.Duration) <-chan time.Time {
+	nw, ok := mc.Registry.(registry.NodeWatcher)
+	if !ok {
+		return time.After(d)
+	}
+
+	ch := make(chan time.Time, 1)
+	go func() {
+		start := time.Now()
+		if err := nw.WaitForNodeChanges(ctx, meshName, d); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.WithError(err).Debug("Unable to wait for node changes, falling back to polling")
+			select {
+			case <-time.After(d - time.Since(start)):
+			case <-ctx.Done():
+				return
+			}
+		}
+		ch <- time.Now()
+	}()
+	return ch
+}
@@ -0,0 +1,73 @@
+package mesh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// number of attempts to update a node entry which is changed concurrently
+	maxNodeUpdateAttempts = 5
+)
+
+// UpdateEndpoint updates the fields ip, listenport for a given node in a mesh
+func (mc *Context) UpdateEndpoint(meshName string, nodeIDKey string, endpointIP string, listenPort int) error {
+	return mc.updateNode(meshName, nodeIDKey, func(nodeInfo *model.NodeInfo) {
+		nodeInfo.ExternalIP = endpointIP
+		nodeInfo.ListenPort = listenPort
+	})
+}
+
+// Heartbeat updates the lastSeen timestamp of a given node in a mesh
+func (mc *Context) Heartbeat(meshName string, nodeIDKey string) error {
+	return mc.updateNode(meshName, nodeIDKey, func(nodeInfo *model.NodeInfo) {})
+}
+
+// updateNode reads the entry of nodeIDKey, applies fn to it, updates its
+// lastSeen timestamp and writes it back. If the registry supports it, the
+// write is a check-and-set, which is retried when the entry has been
+// changed in the meantime.
+func (mc *Context) updateNode(meshName string, nodeIDKey string, fn func(*model.NodeInfo)) error {
+	nv, ok := mc.Registry.(registry.NodeVersions)
+	if !ok {
+		nodeInfo, err := mc.ReadNode(meshName, nodeIDKey)
+		if err != nil {
+			return err
+		}
+		fn(&nodeInfo)
+		nodeInfo.LastSeen = time.Now()
+
+		if err = mc.writeNodeData(meshName, nodeInfo); err != nil {
+			log.WithError(err).Error("Error writing node data")
+			return err
+		}
+		return nil
+	}
+
+	for attempt := 1; attempt <= maxNodeUpdateAttempts; attempt++ {
+		nodeInfo, version, err := nv.ReadNodeVersion(meshName, nodeIDKey)
+		if err != nil {
+			return err
+		}
+		fn(&nodeInfo)
+		nodeInfo.LastSeen = time.Now()
+
+		if err = mc.signNodeData(meshName, &nodeInfo); err != nil {
+			return err
+		}
+		bWritten, err := nv.WriteNodeDataCAS(meshName, nodeInfo, version)
+		if err != nil {
+			log.WithError(err).Error("Error writing node data")
+			return err
+		}
+		if bWritten {
+			return nil
+		}
+		log.WithField("attempt", attempt).Debug("Node entry changed concurrently, retrying")
+	}
+	return fmt.Errorf("unable to update node %s, entry keeps changing", nodeIDKey)
+}
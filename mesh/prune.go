@@ -0,0 +1,122 @@
+package mesh
+
+import (
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ip reservations without a node are released only after this time,
+	// so that nodes which are about to join keep theirs
+	minOrphanedIPAge = 10 * time.Minute
+)
+
+// PruneRequest includes all data necessary to prune expired nodes
+type PruneRequest struct {
+	MeshName string
+	MeshInfo *model.MeshInfo
+	DryRun   bool
+}
+
+// Prune deletes all nodes of a mesh whose last heartbeat is older than the
+// mesh's node TTL, and releases ip reservations of nodes which are gone.
+// Returns the IDs of all expired nodes.
+func (mc *Context) Prune(req *PruneRequest) ([]string, error) {
+	log.WithField("req", *req).Trace("Prune.param")
+
+	res := make([]string, 0)
+
+	nodes, err := mc.ReadNodes(req.MeshName)
+	if err != nil {
+		log.WithError(err).Error("Error reading node list")
+		return res, err
+	}
+
+	now := time.Now()
+	for nodeKey, nodeData := range nodes {
+		if !req.MeshInfo.IsExpired(nodeData, now) {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"id":       nodeKey,
+			"lastSeen": nodeData.LastSeen,
+		}).Debug("Node expired")
+
+		if !req.DryRun {
+			if err := mc.RemoveNode(req.MeshName, nodeKey); err != nil {
+				log.WithError(err).Error("Unable to delete node")
+				return res, err
+			}
+		}
+		res = append(res, nodeKey)
+		delete(nodes, nodeKey)
+	}
+
+	if err := mc.releaseOrphanedIPs(req, nodes, now); err != nil {
+		log.WithError(err).Error("Unable to release ip reservations")
+		return res, err
+	}
+
+	return res, nil
+}
+
+// releaseOrphanedIPs releases all ip reservations whose owner is not in
+// nodes or uses other ips by now, e.g. because the node was not allowed to release them when
+// leaving. Only registries which record the time of reservations are
+// supported, recent reservations are kept.
+func (mc *Context) releaseOrphanedIPs(req *PruneRequest, nodes model.NodeMap, now time.Time) error {
+	rt, ok := mc.Registry.(registry.IPReservationTimes)
+	if !ok {
+		return nil
+	}
+
+	ips, err := mc.ReadIPs(req.MeshName)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		owner, err := mc.ReadIPOwner(req.MeshName, ip)
+		if err != nil {
+			return err
+		}
+		if owner == "" || nodeHoldsIP(nodes, owner, ip) {
+			continue
+		}
+		reservedAt, err := rt.ReadIPReservationTime(req.MeshName, ip)
+		if err != nil {
+			return err
+		}
+		if now.Sub(reservedAt) < minOrphanedIPAge {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"ip":    ip,
+			"owner": owner,
+		}).Info("Releasing ip reservation of removed node")
+		if req.DryRun {
+			continue
+		}
+		if err := mc.ReleaseIP(req.MeshName, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeHoldsIP checks if ip is one of the ips of nodeID
+func nodeHoldsIP(nodes model.NodeMap, nodeID string, ip string) bool {
+	nodeData, ex := nodes[nodeID]
+	if !ex {
+		return false
+	}
+	for _, nodeIP := range nodeData.WireguardIPs() {
+		if nodeIP == ip {
+			return true
+		}
+	}
+	return false
+}
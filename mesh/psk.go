@@ -0,0 +1,121 @@
+package mesh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxPSKWriteAttempts = 3
+
+	// minimum time between staging a new preshared key and switching to it
+	minPSKActivationDelay = 2 * time.Minute
+)
+
+// pskActivationDelay returns the time both nodes of a pair have to pick up
+// a staged preshared key before switching to it. It is a quarter of the
+// rotation interval of the mesh, so that nodes which update less often than
+// that still see the staged key in time.
+func pskActivationDelay(meshInfo *model.MeshInfo) time.Duration {
+	d := time.Duration(meshInfo.PSKRotation) * time.Second / 4
+	if d < minPSKActivationDelay {
+		return minPSKActivationDelay
+	}
+	return d
+}
+
+// pskDue checks if psk is older than the rotation interval of the mesh
+func pskDue(meshInfo *model.MeshInfo, psk *model.PSK, now time.Time) bool {
+	if meshInfo.PSKRotation <= 0 {
+		return false
+	}
+	return now.Sub(psk.Created) > time.Duration(meshInfo.PSKRotation)*time.Second
+}
+
+// peerPSK returns the preshared key for the pair of nodeID and peerID. If there
+// is none yet, it is generated and stored. If the peer did so at the same time,
+// the peer's key is used. A key due for rotation is not replaced at once: the new
+// key is staged with an activation time, both nodes keep the current key until
+// then and switch at that time. Returns the activation time of a staged key, if
+// any, and nil if the mesh does not use preshared keys or the registry is not
+// able to store them.
+func (mc *Context) peerPSK(meshInfo *model.MeshInfo, meshName string, nodeID string, peerID string) (*string, time.Time, error) {
+	store, ok := mc.Registry.(registry.PSKStore)
+	if !ok || !meshInfo.PresharedKeys {
+		return nil, time.Time{}, nil
+	}
+
+	for i := 0; i < maxPSKWriteAttempts; i++ {
+		psk, err := store.ReadPSK(meshName, nodeID, peerID)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		now := time.Now()
+
+		var newPSK model.PSK
+		switch {
+		case psk == nil:
+			key, err := wg.GeneratePresharedKey()
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			newPSK = model.PSK{
+				Key:     key,
+				Created: now,
+			}
+		case psk.Next != "":
+			key := psk.ActiveKey(now)
+			if now.Before(psk.Activation) {
+				return &key, psk.Activation, nil
+			}
+			// staged key is active, make it the current one
+			log.WithField("peer", peerID).Debug("Switching to staged preshared key")
+			newPSK = model.PSK{
+				Key:     key,
+				Created: psk.Activation,
+				Version: psk.Version,
+			}
+		case pskDue(meshInfo, psk, now):
+			key, err := wg.GeneratePresharedKey()
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			log.WithField("peer", peerID).Debug("Staging new preshared key")
+			newPSK = *psk
+			newPSK.Next = key
+			// registries store times with second precision
+			newPSK.Activation = now.Add(pskActivationDelay(meshInfo)).Truncate(time.Second)
+		default:
+			return &psk.Key, time.Time{}, nil
+		}
+
+		bWritten, err := store.WritePSK(meshName, nodeID, peerID, newPSK)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if bWritten {
+			var activation time.Time
+			if newPSK.Next != "" {
+				activation = newPSK.Activation
+			}
+			return &newPSK.Key, activation, nil
+		}
+		log.WithField("peer", peerID).Trace("Preshared key written by peer, reading again")
+	}
+
+	return nil, time.Time{}, fmt.Errorf("unable to store preshared key for peer %s after %d attempts", peerID, maxPSKWriteAttempts)
+}
+
+// removePSKs deletes all preshared keys of nodeID, if the registry stores them
+func (mc *Context) removePSKs(meshName string, nodeID string) error {
+	store, ok := mc.Registry.(registry.PSKStore)
+	if !ok {
+		return nil
+	}
+	return store.DeletePSKs(meshName, nodeID)
+}
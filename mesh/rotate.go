@@ -0,0 +1,353 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultKeyRotationGrace is the default time peers have to install
+	// a new key before the rotation is cancelled
+	DefaultKeyRotationGrace = 10 * time.Minute
+
+	// time between two checks while a key rotation is pending
+	keyRotationPollInterval = 2 * time.Second
+)
+
+// RotateKeyRequest includes all data necessary to rotate the wireguard key of a node
+type RotateKeyRequest struct {
+	MeshName string
+	NodeID   string
+	MeshInfo *model.MeshInfo
+	// Grace is the time all peers have to install the new key. If not all
+	// of them did so by then, the rotation is cancelled.
+	Grace time.Duration
+	// Wait makes RotateKey wait for the switch. Otherwise it is left to
+	// a running agent or the next update.
+	Wait bool
+}
+
+// nextKeyFile returns the path of the file holding the announced,
+// but not yet active private key of this node for meshName
+func nextKeyFile(meshName string) string {
+	return filepath.Join(config.Config().KeyDir, meshName, "wg-next.key")
+}
+
+// RotateKey generates a new wireguard key and announces its public key in
+// the node entry. Peers install the announced key as an additional peer and
+// acknowledge it in their entries. The node keeps its old key until all
+// active peers did so, and only then switches to the new key, so that peers
+// accept the handshakes with it right away. If not all peers installed the
+// key within the grace period, the rotation is cancelled.
+func (mc *Context) RotateKey(req *RotateKeyRequest) error {
+	log.WithField("req", *req).Trace("RotateKey.param")
+
+	wgi, err := setupWireguardForMesh(req.MeshInfo)
+	if err != nil {
+		return err
+	}
+
+	self, err := mc.ReadNode(req.MeshName, req.NodeID)
+	if err != nil {
+		return err
+	}
+	if self.NextPublicKey != "" {
+		// finish pending rotation first
+		if err := mc.finishKeyRotation(wgi, req.MeshInfo, req.MeshName, req.NodeID); err != nil {
+			return err
+		}
+		if self, err = mc.ReadNode(req.MeshName, req.NodeID); err != nil {
+			return err
+		}
+		if self.NextPublicKey != "" {
+			return fmt.Errorf("a key rotation is already pending until %s", self.KeyDeadline.Local().Format(time.RFC3339))
+		}
+	}
+
+	pubkey, deadline, err := mc.announceKey(req.MeshName, req.NodeID, req.Grace)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"pubkey": pubkey,
+		"until":  deadline.Local(),
+	}).Info("Announced new key")
+
+	if !req.Wait {
+		return nil
+	}
+
+	for {
+		<-mc.nodeChanges(context.Background(), req.MeshName, keyRotationPollInterval)
+
+		if err := mc.finishKeyRotation(wgi, req.MeshInfo, req.MeshName, req.NodeID); err != nil {
+			return err
+		}
+		self, err := mc.ReadNode(req.MeshName, req.NodeID)
+		if err != nil {
+			return err
+		}
+		if self.NextPublicKey == "" {
+			if self.WireguardPublicKey != pubkey {
+				return errors.New("key rotation has been cancelled")
+			}
+			return nil
+		}
+	}
+}
+
+// announceKey generates a new key pair, keeps the private key in the key
+// directory and announces the public key in the node entry of nodeID.
+// Returns the public key and the time at which the rotation is cancelled
+// if not all peers installed the key by then.
+func (mc *Context) announceKey(meshName string, nodeID string, grace time.Duration) (string, time.Time, error) {
+	privateKey, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p := nextKeyFile(meshName)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", time.Time{}, err
+	}
+	if err := ioutil.WriteFile(p, []byte(privateKey+"\n"), 0600); err != nil {
+		return "", time.Time{}, err
+	}
+
+	// registries store times with second precision
+	deadline := time.Now().Add(grace).Truncate(time.Second)
+
+	err = mc.updateNode(meshName, nodeID, func(self *model.NodeInfo) {
+		self.NextPublicKey = publicKey
+		self.KeyDeadline = deadline
+	})
+	return publicKey, deadline, err
+}
+
+// finishKeyRotation switches nodeID to its announced key once all active
+// peers have installed it, and cancels the rotation when its deadline has
+// passed before. Does nothing if there is no pending rotation.
+func (mc *Context) finishKeyRotation(wgi *wg.WireguardInterface, meshInfo *model.MeshInfo, meshName string, nodeID string) error {
+	nodes, err := mc.ReadNodes(meshName)
+	if err != nil {
+		return err
+	}
+	self, ex := nodes[nodeID]
+	if !ex {
+		return registry.ErrNodeNotFound
+	}
+	if self.NextPublicKey == "" {
+		return nil
+	}
+	nodes, err = mc.verifyNodes(meshName, nodes)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return mc.advanceKeyRotation(wgi, meshName, self, meshInfo.ActiveNodes(nodes, now), now)
+}
+
+// advanceKeyRotation switches self to its announced key if all active nodes
+// have installed it, or cancels the rotation if its deadline has passed
+func (mc *Context) advanceKeyRotation(wgi *wg.WireguardInterface, meshName string, self model.NodeInfo, nodes model.NodeMap, now time.Time) error {
+	nodeID := self.NodeID
+	missing := missingKeyAcks(self, nodes)
+	if len(missing) == 0 {
+		return mc.activateKey(wgi, meshName, nodeID)
+	}
+	if now.Before(self.KeyDeadline) {
+		log.WithField("peers", missing).Trace("Announced key not yet installed")
+		return nil
+	}
+	log.WithField("peers", missing).Warn("Peers did not install the announced key in time, cancelling key rotation")
+	return mc.cancelKeyRotation(meshName, nodeID)
+}
+
+// missingKeyAcks returns the sorted ids of all nodes other than self
+// which have not yet installed the announced key of self
+func missingKeyAcks(self model.NodeInfo, nodes model.NodeMap) []string {
+	res := make([]string, 0)
+	for nodeKey, nodeData := range nodes {
+		if nodeKey == self.NodeID {
+			continue
+		}
+		if !nodeData.HasAcked(self.NextPublicKey) {
+			res = append(res, nodeKey)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// cancelKeyRotation drops the announced key of nodeID. Peers remove
+// the additional peer of the announced key on their next update.
+func (mc *Context) cancelKeyRotation(meshName string, nodeID string) error {
+	err := mc.updateNode(meshName, nodeID, func(self *model.NodeInfo) {
+		self.NextPublicKey = ""
+		self.KeyDeadline = time.Time{}
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(nextKeyFile(meshName)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Unable to remove announced key")
+	}
+	return nil
+}
+
+// activateKey switches the interface to the announced key of nodeID and
+// makes it the node's current key. Does nothing if there is no pending
+// rotation, e.g. because an agent finished it already.
+func (mc *Context) activateKey(wgi *wg.WireguardInterface, meshName string, nodeID string) error {
+	self, err := mc.ReadNode(meshName, nodeID)
+	if err != nil {
+		return err
+	}
+	if self.NextPublicKey == "" {
+		return nil
+	}
+
+	p := nextKeyFile(meshName)
+	body, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		// rotation was started elsewhere, or the key got lost
+		log.WithField("file", p).Warn("Announced key is not present on this node, cancelling key rotation")
+		return mc.cancelKeyRotation(meshName, nodeID)
+	}
+	if err != nil {
+		return err
+	}
+	privateKey := strings.TrimSpace(string(body))
+
+	publicKey, err := wg.PublicKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("invalid key in %s", p)
+	}
+	if publicKey != self.NextPublicKey {
+		return errors.New("announced key does not match key in " + p)
+	}
+
+	if err := wgi.SetPrivateKey(privateKey); err != nil {
+		return err
+	}
+	if err := mc.storePrivateKey(meshName, nodeID, privateKey); err != nil {
+		return err
+	}
+
+	err = mc.updateNode(meshName, nodeID, func(self *model.NodeInfo) {
+		self.WireguardPublicKey = publicKey
+		self.NextPublicKey = ""
+		self.KeyDeadline = time.Time{}
+		self.KeyActivation = time.Now().Truncate(time.Second)
+	})
+	if err != nil {
+		return err
+	}
+	log.WithField("pubkey", publicKey).Info("Switched to new key")
+
+	if err := os.Remove(p); err != nil {
+		log.WithError(err).Warn("Unable to remove announced key")
+	}
+	return nil
+}
+
+// installAnnouncedKey adds the announced key of a peer as an additional peer
+// without allowed ips, so that handshakes with it succeed as soon as the peer
+// switches. Once such a handshake happened, the allowed ips of the peer are
+// moved to it. Returns the public key under which the peer is reachable.
+func installAnnouncedKey(wgi *wg.WireguardInterface, nodeData model.NodeInfo, psk *string, handshakes map[string]time.Time) (string, error) {
+	if !handshakes[nodeData.NextPublicKey].IsZero() {
+		log.WithField("pubkey", nodeData.NextPublicKey).Debug("Peer switched to announced key")
+		return nodeData.NextPublicKey, nil
+	}
+	if _, err := wgi.AddPeer(nodeData.ExternalIP, nodeData.ListenPort, nodeData.NextPublicKey, nil, psk); err != nil {
+		return "", err
+	}
+	return nodeData.WireguardPublicKey, nil
+}
+
+// ackKeys records the installed announced keys of other nodes in the entry
+// of self, and drops acknowledgements of rotations which are over
+func (mc *Context) ackKeys(meshName string, self model.NodeInfo, acks []string) error {
+	sort.Strings(acks)
+	if sameKeys(acks, self.KeyAcks) {
+		return nil
+	}
+	log.WithField("keys", acks).Debug("Acknowledging announced keys")
+	return mc.updateNode(meshName, self.NodeID, func(self *model.NodeInfo) {
+		self.KeyAcks = acks
+	})
+}
+
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keyRotationDue checks if a new key should be announced for self. Keys
+// which have never been rotated count as active since given time.
+func keyRotationDue(self model.NodeInfo, interval time.Duration, since time.Time, now time.Time) bool {
+	if self.NextPublicKey != "" {
+		return false
+	}
+	activated := self.KeyActivation
+	if activated.IsZero() {
+		activated = since
+	}
+	return now.Sub(activated) >= interval
+}
+
+// keyRotationPending checks if a key rotation involving self is under way,
+// i.e. if any node announced a key, or self still acknowledges a key of
+// a node which may just have switched to it
+func keyRotationPending(self model.NodeInfo, nodes model.NodeMap) bool {
+	if len(self.KeyAcks) > 0 {
+		return true
+	}
+	for _, nodeData := range nodes {
+		if nodeData.NextPublicKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// earliest returns the earlier of two times, ignoring zero times
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// untilNextCheck shortens d so that a wait of d ends at next,
+// if next is set
+func untilNextCheck(d time.Duration, next time.Time) time.Duration {
+	if next.IsZero() {
+		return d
+	}
+	if untilNext := time.Until(next); untilNext < d {
+		return untilNext
+	}
+	return d
+}
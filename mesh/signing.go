@@ -0,0 +1,168 @@
+package mesh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errSignerMismatch = errors.New("node id is registered with another signing key")
+)
+
+// signingKeyFile returns the path of the file holding this node's
+// signing key for meshName
+func signingKeyFile(meshName string) string {
+	return filepath.Join(config.Config().KeyDir, meshName, "signing.key")
+}
+
+// loadOrCreateSigningKey reads the signing key for meshName from the key
+// directory. If there is none, a new one is generated and stored.
+func loadOrCreateSigningKey(meshName string) (ed25519.PrivateKey, error) {
+	p := signingKeyFile(meshName)
+
+	body, err := ioutil.ReadFile(p)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid signing key in %s", p)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(p, []byte(base64.StdEncoding.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	log.WithField("file", p).Debug("Created signing key")
+
+	return key, nil
+}
+
+// signingKey returns the signing key of nodeID for meshName and makes sure
+// its public key is registered. Fails if another key is registered for nodeID.
+func (mc *Context) signingKey(meshName string, nodeID string) (ed25519.PrivateKey, error) {
+	if key, ok := mc.signingKeys[meshName]; ok {
+		return key, nil
+	}
+
+	key, err := loadOrCreateSigningKey(meshName)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	bRegistered, err := mc.RegisterSigner(meshName, nodeID, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bRegistered {
+		return nil, errSignerMismatch
+	}
+
+	mc.signingKeys[meshName] = key
+	return key, nil
+}
+
+// writeNodeData signs nodeInfo and writes it to the registry
+func (mc *Context) writeNodeData(meshName string, nodeInfo model.NodeInfo) error {
+	if err := mc.signNodeData(meshName, &nodeInfo); err != nil {
+		return err
+	}
+	return mc.WriteNodeData(meshName, nodeInfo)
+}
+
+// signNodeData sets the signature of nodeInfo
+func (mc *Context) signNodeData(meshName string, nodeInfo *model.NodeInfo) error {
+	key, err := mc.signingKey(meshName, nodeInfo.NodeID)
+	if err != nil {
+		return err
+	}
+	nodeInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, nodeInfo.SigningPayload()))
+	return nil
+}
+
+// verifyNode checks that ni carries a valid signature of the signer
+// registered for nodeID
+func verifyNode(nodeID string, ni model.NodeInfo, signers map[string]string) error {
+	if ni.NodeID != nodeID {
+		return fmt.Errorf("entry is for node id %s", ni.NodeID)
+	}
+	if ni.Signature == "" {
+		return errors.New("entry is not signed")
+	}
+	signer, ok := signers[nodeID]
+	if !ok {
+		return errors.New("no signer registered")
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(signer)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid signer")
+	}
+	signature, err := base64.StdEncoding.DecodeString(ni.Signature)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), ni.SigningPayload(), signature) {
+		return errors.New("signature does not match, entry has been tampered with")
+	}
+	return nil
+}
+
+// verifyNodes returns all nodes which carry a valid signature. Tampered
+// entries are logged and left out. Unsigned entries of nodes without a
+// registered signer, i.e. nodes which did not run a version with
+// signatures yet, are accepted with a warning unless signatures are required.
+func (mc *Context) verifyNodes(meshName string, nodes model.NodeMap) (model.NodeMap, error) {
+	signers, err := mc.ReadSigners(meshName)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(model.NodeMap, len(nodes))
+	for nodeKey, nodeData := range nodes {
+		if _, ok := signers[nodeKey]; !ok && nodeData.Signature == "" && !config.Config().RequireSignatures {
+			mc.warnUnsigned(meshName, nodeKey)
+			res[nodeKey] = nodeData
+			continue
+		}
+		if err := verifyNode(nodeKey, nodeData, signers); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"id":     nodeKey,
+				"pubkey": nodeData.WireguardPublicKey,
+			}).Warn("Rejecting node entry")
+			continue
+		}
+		res[nodeKey] = nodeData
+	}
+	return res, nil
+}
+
+// warnUnsigned warns once about an accepted unsigned node entry
+func (mc *Context) warnUnsigned(meshName string, nodeID string) {
+	key := meshName + "/" + nodeID
+	if mc.unsignedWarned[key] {
+		return
+	}
+	mc.unsignedWarned[key] = true
+	log.WithField("id", nodeID).Warn("Accepting unsigned node entry until the node runs a version signing it. Use --require-signatures to ignore unsigned entries.")
+}
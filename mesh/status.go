@@ -0,0 +1,125 @@
+package mesh
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusRequest includes all data necessary to query the status of a mesh
+type StatusRequest struct {
+	MeshName string
+	NodeID   string
+	MeshInfo *model.MeshInfo
+}
+
+// NodeStatus combines a node entry from the registry with the data of the
+// matching local wireguard peer, if present
+type NodeStatus struct {
+	NodeID        string    `json:"id"`
+	WireguardIPs  []string  `json:"ips"`
+	PublicKey     string    `json:"pubkey"`
+	Endpoint      string    `json:"endpoint"`
+	LastSeen      time.Time `json:"lastSeen"`
+	Expired       bool      `json:"expired"`
+	Self          bool      `json:"self"`
+	PeerPresent   bool      `json:"peerPresent"`
+	LastHandshake time.Time `json:"lastHandshake"`
+	ReceiveBytes  int64     `json:"rxBytes"`
+	TransmitBytes int64     `json:"txBytes"`
+}
+
+// MeshStatus is the combined status of a mesh from the registry and
+// the local wireguard interface
+type MeshStatus struct {
+	MeshInfo         *model.MeshInfo `json:"mesh"`
+	InterfaceName    string          `json:"interface"`
+	InterfacePresent bool            `json:"interfacePresent"`
+	Nodes            []NodeStatus    `json:"nodes"`
+	// UnknownPeers are local peers without a node entry in the registry
+	UnknownPeers []wg.PeerInfo `json:"unknownPeers"`
+}
+
+// Status reads the node list of a mesh and matches it against
+// the peers of the local wireguard interface
+func (mc *Context) Status(req *StatusRequest) (*MeshStatus, error) {
+	log.WithField("req", *req).Trace("Status.param")
+
+	nodes, err := mc.ReadNodes(req.MeshName)
+	if err != nil {
+		log.WithError(err).Error("Error reading node list")
+		return nil, err
+	}
+
+	res := &MeshStatus{
+		MeshInfo:      req.MeshInfo,
+		InterfaceName: fmt.Sprintf("wg-%s", req.MeshInfo.Name),
+		Nodes:         make([]NodeStatus, 0, len(nodes)),
+		UnknownPeers:  make([]wg.PeerInfo, 0),
+	}
+
+	wgi := &wg.WireguardInterface{
+		InterfaceName: res.InterfaceName,
+	}
+	peersByPubkey := make(map[string]wg.PeerInfo)
+	ex, err := wgi.HasInterface()
+	if err == nil && ex {
+		res.InterfacePresent = true
+
+		peers, err := wgi.Peers()
+		if err != nil {
+			log.WithError(err).Error("Unable to read peers of wireguard interface")
+			return nil, err
+		}
+		for _, peer := range peers {
+			peersByPubkey[peer.PublicKey] = peer
+		}
+	}
+
+	now := time.Now()
+	knownPubkeys := make(map[string]bool)
+	for nodeKey, nodeData := range nodes {
+		pubkey := nodeData.WireguardPublicKey
+		knownPubkeys[pubkey] = true
+
+		ns := NodeStatus{
+			NodeID:       nodeKey,
+			WireguardIPs: nodeData.WireguardIPs(),
+			PublicKey:    pubkey,
+			Endpoint:     nodeData.ExternalIP,
+			LastSeen:     nodeData.LastSeen,
+			Expired:      req.MeshInfo.IsExpired(nodeData, now),
+			Self:         nodeKey == req.NodeID,
+		}
+		if nodeData.ExternalIP != "" {
+			ns.Endpoint = net.JoinHostPort(nodeData.ExternalIP, strconv.Itoa(nodeData.ListenPort))
+		}
+		if peer, ex := peersByPubkey[pubkey]; ex {
+			ns.PeerPresent = true
+			ns.LastHandshake = peer.LastHandshake
+			ns.ReceiveBytes = peer.ReceiveBytes
+			ns.TransmitBytes = peer.TransmitBytes
+		}
+		res.Nodes = append(res.Nodes, ns)
+	}
+	sort.Slice(res.Nodes, func(i, j int) bool {
+		return res.Nodes[i].NodeID < res.Nodes[j].NodeID
+	})
+
+	for pubkey, peer := range peersByPubkey {
+		if !knownPubkeys[pubkey] {
+			res.UnknownPeers = append(res.UnknownPeers, peer)
+		}
+	}
+	sort.Slice(res.UnknownPeers, func(i, j int) bool {
+		return res.UnknownPeers[i].PublicKey < res.UnknownPeers[j].PublicKey
+	})
+
+	return res, nil
+}
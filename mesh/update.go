@@ -0,0 +1,248 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/wg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHeartbeatInterval = 60 * time.Second
+)
+
+// UpdateRequest includes all data necessary to process peer updates
+type UpdateRequest struct {
+	MeshName string
+	NodeID   string
+	MeshInfo *model.MeshInfo
+	WaitSecs int
+}
+
+// Update takes data from the UpdateRequest to listen for peer updates
+func (mc *Context) Update(req *UpdateRequest) error {
+	log.WithField("req", *req).Trace("Update.param")
+
+	// ensure we have a wireguard interface w/ key
+	wgi, err := mc.setupWireguardForUpdate(req)
+	if err != nil {
+		log.WithError(err).Error("Unable to set up wireguard interface")
+		return err
+	}
+
+	// at this point, we have a local wg interface with a public key
+	// that's uniquely present in the nodelist.
+	// - Assign the overlay IP address to the interface
+	log.WithField("wgi", wgi).Trace("Update.dump")
+
+	// determine times and durations
+	sleepTimeSecs := req.WaitSecs / 10
+	if sleepTimeSecs < 5 {
+		sleepTimeSecs = 5
+	}
+	if sleepTimeSecs > 60 {
+		sleepTimeSecs = 60
+	}
+	finishTime := time.Now().Local().Add(time.Second * time.Duration(req.WaitSecs))
+	log.WithFields(log.Fields{
+		"finishAt":      finishTime,
+		"sleepTimeSecs": sleepTimeSecs,
+	}).Trace("Running at least once until")
+
+	for {
+		next, err := mc.reconcile(wgi, req.MeshInfo, req.MeshName, req.NodeID)
+		if err != nil {
+			return err
+		}
+
+		if req.WaitSecs > 0 {
+			<-mc.nodeChanges(context.Background(), req.MeshName, untilNextCheck(time.Second*time.Duration(sleepTimeSecs), next))
+		}
+		if time.Now().After(finishTime) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// reconcile brings the peers of wgi in line with the node list of meshName
+// in a single pass: adds peers for all nodes that are not yet connected and
+// removes all peers that are not in the node list any more or expired.
+// Sends a heartbeat for nodeID, installs and acknowledges keys announced by
+// other nodes and switches to the announced key of nodeID once all peers
+// have installed it.
+// Returns the time of the next pass while a key rotation is pending, resp.
+// the activation time of a staged preshared key.
+func (mc *Context) reconcile(wgi *wg.WireguardInterface, meshInfo *model.MeshInfo, meshName string, nodeID string) (time.Time, error) {
+	// query all nodes.
+	nodes, err := mc.ReadNodes(meshName)
+	if err != nil {
+		log.WithError(err).Error("Error reading node list")
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	self, bSelf := nodes[nodeID]
+	if bSelf {
+		if now.Sub(self.LastSeen) >= heartbeatInterval(meshInfo) {
+			if err := mc.Heartbeat(meshName, nodeID); err != nil {
+				return time.Time{}, err
+			}
+			log.WithField("id", nodeID).Trace("Sent heartbeat")
+		}
+	} else {
+		log.WithField("id", nodeID).Warn("This node is not in the node list any more, must join again")
+	}
+
+	// treat expired nodes and nodes without valid signatures as gone
+	nodes, err = mc.verifyNodes(meshName, nodes)
+	if err != nil {
+		log.WithError(err).Error("Error reading signers")
+		return time.Time{}, err
+	}
+	nodes = meshInfo.ActiveNodes(nodes, now)
+
+	var next time.Time
+	bRotating := bSelf && keyRotationPending(self, nodes)
+	if bRotating {
+		next = now.Add(keyRotationPollInterval)
+	}
+
+	// peers which announced a key are reachable under the announced one
+	// as soon as they had a handshake with it
+	handshakes := make(map[string]time.Time)
+	if bRotating {
+		peers, err := wgi.Peers()
+		if err != nil {
+			log.WithError(err).Error("Unable to read peers of wireguard interface")
+			return time.Time{}, err
+		}
+		for _, peer := range peers {
+			handshakes[peer.PublicKey] = peer.LastHandshake
+		}
+	}
+	acks := make([]string, 0)
+
+	// connect to all others which are not yet connected
+	for nodeKey, nodeData := range nodes {
+		if nodeKey == nodeID {
+			// this is us.
+			continue
+		}
+
+		psk, activation, err := mc.peerPSK(meshInfo, meshName, nodeID, nodeKey)
+		if err != nil {
+			log.WithError(err).WithField("peer", nodeKey).Error("Unable to get preshared key for peer, skipping")
+			continue
+		}
+		next = earliest(next, activation)
+
+		pubkey := nodeData.WireguardPublicKey
+		if nodeData.NextPublicKey != "" {
+			pubkey, err = installAnnouncedKey(wgi, nodeData, psk, handshakes)
+			if err != nil {
+				log.WithError(err).WithField("peer", nodeKey).Error("Unable to install announced key of peer")
+				pubkey = nodeData.WireguardPublicKey
+			} else {
+				acks = append(acks, nodeData.NextPublicKey)
+			}
+		}
+
+		allowedIP := wg.HostNets(nodeData.WireguardIPs())
+		bAdded, err := wgi.AddPeer(nodeData.ExternalIP, nodeData.ListenPort, pubkey, allowedIP, psk)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"data": nodeData,
+			}).Error("Error adding wireguard peer")
+		}
+		if bAdded {
+			log.WithFields(log.Fields{
+				"key":       nodeKey,
+				"othernode": nodeData,
+			}).Debug("Added wg peer")
+		}
+	}
+
+	if bSelf {
+		if err := mc.ackKeys(meshName, self, acks); err != nil {
+			log.WithError(err).Error("Unable to acknowledge announced keys")
+			return time.Time{}, err
+		}
+		if self.NextPublicKey != "" {
+			if err := mc.advanceKeyRotation(wgi, meshName, self, nodes, now); err != nil {
+				log.WithError(err).Error("Unable to switch to announced key")
+				return time.Time{}, err
+			}
+		}
+	}
+
+	// scan through peer list of my own interface, remove all nodes
+	// that are not in node list any more. Announced keys are kept.
+	removalList := make([]string, 0)
+
+	err = wgi.IterateWgPeers(func(pubkey string) {
+		bFound := false
+		for nodeKey, nodeData := range nodes {
+			if nodeKey == nodeID {
+				// this is us.
+				continue
+			}
+			if nodeData.WireguardPublicKey == pubkey || nodeData.NextPublicKey == pubkey {
+				bFound = true
+			}
+		}
+		if !bFound {
+			removalList = append(removalList, pubkey)
+		}
+	})
+	if err != nil {
+		log.WithError(err).Error("Unable to read peers of wireguard interface")
+		return time.Time{}, err
+	}
+
+	log.WithField("removalList", removalList).Trace("Update.dump")
+	for _, pubkeyPeerToRemove := range removalList {
+		err = wgi.RemoveWgPeer(pubkeyPeerToRemove)
+		if err != nil {
+			log.WithError(err).Debug("Unable to remove peer")
+		}
+	}
+
+	return next, nil
+}
+
+// heartbeatInterval returns the time between two heartbeats, so that
+// a node sends three heartbeats within the node ttl of a mesh
+func heartbeatInterval(meshInfo *model.MeshInfo) time.Duration {
+	if meshInfo.NodeTTL <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return time.Duration(meshInfo.NodeTTL) * time.Second / 3
+}
+
+func (mc *Context) setupWireguardForUpdate(req *UpdateRequest) (*wg.WireguardInterface, error) {
+	return setupWireguardForMesh(req.MeshInfo)
+}
+
+// setupWireguardForMesh returns the existing wireguard interface of a mesh,
+// which must have been joined before.
+func setupWireguardForMesh(meshInfo *model.MeshInfo) (*wg.WireguardInterface, error) {
+	wgi := &wg.WireguardInterface{
+		InterfaceName: fmt.Sprintf("wg-%s", meshInfo.Name),
+	}
+	ex, err := wgi.HasInterface()
+	if err != nil || ex == false {
+		return nil, errors.New("must have joined first before updating")
+	}
+
+	err = wgi.SetupInterfaceWithConfig()
+
+	return wgi, err
+
+}
@@ -1,7 +1,57 @@
 package model
 
+import "time"
+
 // MeshInfo holds basic information about the wireguard mesh
 type MeshInfo struct {
-	Name        string `json:"name"`
+	Name string `json:"name"`
+	// NetworkCIDR is the IPv4 network of the mesh, or the IPv6
+	// network for IPv6-only meshes
 	NetworkCIDR string `json:"network"`
+	// NetworkCIDR6 is the IPv6 network of a dual-stack mesh
+	NetworkCIDR6   string   `json:"network6,omitempty"`
+	ReservedRanges []string `json:"reserved,omitempty"`
+	// NodeTTL is the number of seconds after which a node that did not
+	// send a heartbeat is considered gone. 0 disables expiry.
+	NodeTTL int `json:"nodeTTL,omitempty"`
+	// Namespace is the vault namespace the mesh is kept in,
+	// if other than the default one
+	Namespace string `json:"namespace,omitempty"`
+	// TransitKey is the name of the vault transit key node
+	// records are encrypted with, if any
+	TransitKey string `json:"transitKey,omitempty"`
+	// PresharedKeys enables preshared keys for each pair of nodes
+	PresharedKeys bool `json:"psk,omitempty"`
+	// PSKRotation is the number of seconds after which preshared keys
+	// are replaced. 0 disables rotation.
+	PSKRotation int `json:"pskRotation,omitempty"`
+}
+
+// IsExpired checks if the last heartbeat of ni is older than the mesh's
+// node TTL. Nodes which never sent a heartbeat do not expire.
+func (mi *MeshInfo) IsExpired(ni NodeInfo, now time.Time) bool {
+	if mi.NodeTTL <= 0 || ni.LastSeen.IsZero() {
+		return false
+	}
+	return now.Sub(ni.LastSeen) > time.Duration(mi.NodeTTL)*time.Second
+}
+
+// ActiveNodes returns all nodes which are not expired
+func (mi *MeshInfo) ActiveNodes(nodes NodeMap, now time.Time) NodeMap {
+	res := make(NodeMap, len(nodes))
+	for key, ni := range nodes {
+		if !mi.IsExpired(ni, now) {
+			res[key] = ni
+		}
+	}
+	return res
+}
+
+// Networks returns all networks of the mesh in CIDR format
+func (mi *MeshInfo) Networks() []string {
+	res := []string{mi.NetworkCIDR}
+	if mi.NetworkCIDR6 != "" {
+		res = append(res, mi.NetworkCIDR6)
+	}
+	return res
 }
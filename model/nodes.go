@@ -1,12 +1,84 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // NodeInfo describes a single node.
 type NodeInfo struct {
-	NodeID             string
-	WireguardIP        string
-	WireguardPublicKey string
-	ExternalIP         string
-	ListenPort         int
+	NodeID string `json:"nodeID"`
+	// WireguardIP is the overlay ip from MeshInfo.NetworkCIDR
+	WireguardIP string `json:"wgip"`
+	// WireguardIP6 is the overlay ip from MeshInfo.NetworkCIDR6, if any
+	WireguardIP6       string `json:"wgip6,omitempty"`
+	WireguardPublicKey string `json:"pubkey"`
+	ExternalIP         string `json:"endpointIP"`
+	ListenPort         int    `json:"endpointPort"`
+	// LastSeen is the time of the last heartbeat of the node
+	LastSeen time.Time `json:"lastSeen"`
+	// Signature is the base64-encoded ed25519 signature of SigningPayload,
+	// made with the node's signing key
+	Signature string `json:"signature,omitempty"`
+	// KeyActivation is the time at which the current key became active
+	// after a rotation
+	KeyActivation time.Time `json:"keyActivation"`
+	// NextPublicKey is the wireguard public key the node switches to once
+	// all peers have installed it
+	NextPublicKey string `json:"nextPubkey,omitempty"`
+	// KeyDeadline is the time at which the rotation to NextPublicKey is
+	// cancelled if not all peers have installed it
+	KeyDeadline time.Time `json:"keyDeadline"`
+	// KeyAcks lists the announced NextPublicKeys of other nodes which
+	// this node has installed as additional peers
+	KeyAcks []string `json:"keyAcks,omitempty"`
+}
+
+// HasAcked checks if the node has installed the announced key pubkey
+func (ni *NodeInfo) HasAcked(pubkey string) bool {
+	for _, ack := range ni.KeyAcks {
+		if ack == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningPayload returns the canonical form of all fields of the node
+// which are covered by its signature. LastSeen is included with second
+// precision, as stored by all registries. Key rotation fields are only
+// included if set, so that entries signed before rotations were supported
+// stay valid. Once set, clearing them breaks the signature as well.
+func (ni *NodeInfo) SigningPayload() []byte {
+	payload := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%d\n%s",
+		ni.NodeID,
+		ni.WireguardIP,
+		ni.WireguardIP6,
+		ni.WireguardPublicKey,
+		ni.ExternalIP,
+		ni.ListenPort,
+		ni.LastSeen.UTC().Format(time.RFC3339),
+	)
+	if !ni.KeyActivation.IsZero() {
+		payload += fmt.Sprintf("\nkeyActivation=%s", ni.KeyActivation.UTC().Format(time.RFC3339))
+	}
+	if ni.NextPublicKey != "" {
+		payload += fmt.Sprintf("\nnextPubkey=%s\nkeyDeadline=%s", ni.NextPublicKey, ni.KeyDeadline.UTC().Format(time.RFC3339))
+	}
+	if len(ni.KeyAcks) > 0 {
+		payload += fmt.Sprintf("\nkeyAcks=%s", strings.Join(ni.KeyAcks, ","))
+	}
+	return []byte(payload)
+}
+
+// WireguardIPs returns all overlay ips of the node
+func (ni *NodeInfo) WireguardIPs() []string {
+	res := []string{ni.WireguardIP}
+	if ni.WireguardIP6 != "" {
+		res = append(res, ni.WireguardIP6)
+	}
+	return res
 }
 
 // Nodes is a list of NodeInfos
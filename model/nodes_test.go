@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigningPayload(t *testing.T) {
+	activation := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	base := NodeInfo{
+		NodeID:             "node1",
+		WireguardIP:        "10.0.0.1",
+		WireguardPublicKey: "pubkey1",
+		ExternalIP:         "192.168.0.1",
+		ListenPort:         54540,
+		LastSeen:           activation,
+	}
+	legacy := "node1\n10.0.0.1\n\npubkey1\n192.168.0.1\n54540\n2020-05-01T12:00:00Z"
+
+	tests := []struct {
+		name   string
+		modify func(*NodeInfo)
+		want   string
+	}{
+		{"entry without rotation", func(ni *NodeInfo) {}, legacy},
+		{"rotated key", func(ni *NodeInfo) {
+			ni.KeyActivation = activation
+		}, legacy + "\nkeyActivation=2020-05-01T12:00:00Z"},
+		{"pending rotation", func(ni *NodeInfo) {
+			ni.KeyActivation = activation
+			ni.NextPublicKey = "pubkey2"
+			ni.KeyDeadline = activation.Add(10 * time.Minute)
+		}, legacy + "\nkeyActivation=2020-05-01T12:00:00Z\nnextPubkey=pubkey2\nkeyDeadline=2020-05-01T12:10:00Z"},
+		{"acknowledged keys", func(ni *NodeInfo) {
+			ni.KeyAcks = []string{"pubkeyA", "pubkeyB"}
+		}, legacy + "\nkeyAcks=pubkeyA,pubkeyB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ni := base
+			tt.modify(&ni)
+			if got := string(ni.SigningPayload()); got != tt.want {
+				t.Errorf("SigningPayload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
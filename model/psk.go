@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PSK is a wireguard preshared key shared by a pair of nodes
+type PSK struct {
+	Key     string    `json:"psk"`
+	Created time.Time `json:"created"`
+	// Next is the key replacing Key at Activation. It is staged in advance,
+	// so that both nodes switch at the same time.
+	Next       string    `json:"next,omitempty"`
+	Activation time.Time `json:"activation"`
+	// Version is the registry's version of the stored key, used for
+	// check-and-set writes. 0 if not stored yet.
+	Version int `json:"-"`
+}
+
+// ActiveKey returns the key both nodes should use at given time
+func (p *PSK) ActiveKey(now time.Time) string {
+	if p.Next != "" && !now.Before(p.Activation) {
+		return p.Next
+	}
+	return p.Key
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+)
+
+var (
+	// ErrNodeNotFound is returned when reading a node that has no entry in the registry
+	ErrNodeNotFound = errors.New("node not found")
+)
+
+// Registry stores the meeting points and node entries of meshes.
+// Implementations are backed by a key/value store, e.g. Vault's
+// KV secrets engine.
+type Registry interface {
+	// ListMeshes returns the names of all meshes
+	ListMeshes() ([]string, error)
+
+	// ReadMeetingPoint returns the mesh data of meshName, or nil
+	// if there is no meeting point for meshName
+	ReadMeetingPoint(meshName string) (*model.MeshInfo, error)
+	// CreateMeetingPoint stores a new meeting point. Returns false
+	// if a meeting point with that name is already present.
+	CreateMeetingPoint(mi model.MeshInfo) (bool, error)
+	// DeleteMeetingPoint removes the meeting point of meshName. Returns
+	// false if there is no meeting point.
+	DeleteMeetingPoint(meshName string) (bool, error)
+
+	// ReadNodes returns all node entries of meshName, keyed by node ID
+	ReadNodes(meshName string) (model.NodeMap, error)
+	// ReadNode returns a single node entry or ErrNodeNotFound
+	ReadNode(meshName string, nodeID string) (model.NodeInfo, error)
+	// WriteNodeData creates or replaces the entry for nodeInfo.NodeID
+	WriteNodeData(meshName string, nodeInfo model.NodeInfo) error
+	// DeleteNode removes a node entry
+	DeleteNode(meshName string, nodeID string) error
+
+	// ReserveIP atomically reserves ip for nodeID. Returns true if ip is
+	// reserved for nodeID, either by this call or before, false if another
+	// node holds it.
+	ReserveIP(meshName string, ip string, nodeID string) (bool, error)
+	// ReadIPOwner returns the ID of the node holding ip, or an empty string
+	ReadIPOwner(meshName string, ip string) (string, error)
+	// ReleaseIP removes the reservation of ip
+	ReleaseIP(meshName string, ip string) error
+	// ReadIPs returns all reserved ips of meshName
+	ReadIPs(meshName string) ([]string, error)
+
+	// RegisterSigner stores the public signing key of nodeID, only if none
+	// is registered yet. Returns true if publicKey is registered for nodeID,
+	// either by this call or before, false if another key is registered.
+	RegisterSigner(meshName string, nodeID string, publicKey string) (bool, error)
+	// ReadSigners returns the public signing keys of meshName, keyed by node ID
+	ReadSigners(meshName string) (map[string]string, error)
+	// DeleteSigner removes the public signing key of nodeID
+	DeleteSigner(meshName string, nodeID string) error
+}
+
+// NodeWatcher is implemented by registries which are able to wait for
+// changes of node entries, instead of being polled.
+type NodeWatcher interface {
+	// WaitForNodeChanges blocks until node entries of meshName changed
+	// since they were last read, until timeout has passed or until ctx
+	// is cancelled.
+	WaitForNodeChanges(ctx context.Context, meshName string, timeout time.Duration) error
+}
+
+// PSKStore is implemented by registries which are able to store preshared
+// keys for pairs of nodes, readable only by these two nodes.
+type PSKStore interface {
+	// ReadPSK returns the preshared key of the pair nodeA, nodeB (in any
+	// order), or nil if there is none
+	ReadPSK(meshName string, nodeA string, nodeB string) (*model.PSK, error)
+	// WritePSK stores psk for the pair nodeA, nodeB, if the stored key still
+	// has psk.Version (0: no key stored). Returns false if the key has been
+	// written by someone else in the meantime.
+	WritePSK(meshName string, nodeA string, nodeB string, psk model.PSK) (bool, error)
+	// DeletePSKs removes all preshared keys of nodeID
+	DeletePSKs(meshName string, nodeID string) error
+}
+
+// NodeVersions is implemented by registries which are able to update
+// node entries using check-and-set writes
+type NodeVersions interface {
+	// ReadNodeVersion returns the entry of nodeID along with its version
+	ReadNodeVersion(meshName string, nodeID string) (model.NodeInfo, int, error)
+	// WriteNodeDataCAS replaces the entry of nodeInfo.NodeID if it still has
+	// version. Returns false if it has been changed in the meantime.
+	WriteNodeDataCAS(meshName string, nodeInfo model.NodeInfo, version int) (bool, error)
+}
+
+// IPReservationTimes is implemented by registries which keep the time
+// at which ips have been reserved
+type IPReservationTimes interface {
+	// ReadIPReservationTime returns the time ip has been reserved at, or
+	// the zero time if it is not known
+	ReadIPReservationTime(meshName string, ip string) (time.Time, error)
+}
+
+// KeyStore is implemented by registries which are able to keep the
+// wireguard private key of a node, readable only by the node itself.
+type KeyStore interface {
+	// ReadPrivateKey returns the private key of nodeID, or "" if there is none
+	ReadPrivateKey(meshName string, nodeID string) (string, error)
+	// WritePrivateKey stores the private key of nodeID
+	WritePrivateKey(meshName string, nodeID string, privateKey string) error
+	// DeletePrivateKey removes the private key of nodeID
+	DeletePrivateKey(meshName string, nodeID string) error
+}
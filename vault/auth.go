@@ -0,0 +1,260 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// loginFunc authenticates against an auth method and returns
+// the secret containing the client token
+type loginFunc func(client *api.Client) (*api.Secret, error)
+
+var (
+	// loginFuncs maps the names of supported auth methods (WGVAM_VAULT_AUTH)
+	// to their login function. "token" is handled separately.
+	loginFuncs = map[string]loginFunc{
+		"approle":    loginAppRole,
+		"kubernetes": loginKubernetes,
+		"jwt":        loginJWT,
+		"cert":       loginCert,
+	}
+)
+
+const (
+	defaultKubernetesJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	minReloginBackoff = 5 * time.Second
+	maxReloginBackoff = 5 * time.Minute
+)
+
+// readValueOrFile returns value if set, otherwise the trimmed content of file
+func readValueOrFile(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// loginAppRole authenticates using role_id and secret_id against
+// the approle auth method
+func loginAppRole(client *api.Client) (*api.Secret, error) {
+	c := config.Config()
+
+	roleID, err := readValueOrFile(c.VaultAppRoleRoleID, c.VaultAppRoleRoleIDFile)
+	if err != nil {
+		return nil, err
+	}
+	if roleID == "" {
+		return nil, errors.New("approle auth needs a role id (env: WGVAM_VAULT_APPROLE_ROLE_ID or WGVAM_VAULT_APPROLE_ROLE_ID_FILE)")
+	}
+	secretID, err := readValueOrFile(c.VaultAppRoleSecretID, c.VaultAppRoleSecretIDFile)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"role_id": roleID,
+	}
+	if secretID != "" {
+		data["secret_id"] = secretID
+	}
+
+	return client.Logical().Write(fmt.Sprintf("auth/%s/login", strings.Trim(c.VaultAppRoleMount, "/")), data)
+}
+
+// loginKubernetes authenticates using the pod's service account token
+// against the kubernetes auth method
+func loginKubernetes(client *api.Client) (*api.Secret, error) {
+	return loginWithJWT(client, "kubernetes", defaultKubernetesJWTPath)
+}
+
+// loginJWT authenticates using a JWT (e.g. from a CI runner or an OIDC provider)
+// against the jwt auth method
+func loginJWT(client *api.Client) (*api.Secret, error) {
+	return loginWithJWT(client, "jwt", "")
+}
+
+// loginWithJWT reads a JWT from the configured path (or defaultPath) and
+// logs in using the configured role at the auth mount (or defaultMount)
+func loginWithJWT(client *api.Client, defaultMount, defaultPath string) (*api.Secret, error) {
+	c := config.Config()
+
+	if c.VaultAuthRole == "" {
+		return nil, fmt.Errorf("%s auth needs a role (env: WGVAM_VAULT_AUTH_ROLE)", c.VaultAuth)
+	}
+	jwtPath := c.VaultJWTPath
+	if jwtPath == "" {
+		jwtPath = defaultPath
+	}
+	if jwtPath == "" {
+		return nil, fmt.Errorf("%s auth needs a path to a JWT (env: WGVAM_VAULT_JWT_PATH)", c.VaultAuth)
+	}
+	jwt, err := readValueOrFile("", jwtPath)
+	if err != nil {
+		return nil, err
+	}
+	if jwt == "" {
+		return nil, fmt.Errorf("JWT at %s is empty", jwtPath)
+	}
+
+	mount := c.VaultAuthMount
+	if mount == "" {
+		mount = defaultMount
+	}
+
+	return client.Logical().Write(fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/")), map[string]interface{}{
+		"role": c.VaultAuthRole,
+		"jwt":  jwt,
+	})
+}
+
+// loginCert authenticates using the TLS client certificate
+// against the cert auth method
+func loginCert(client *api.Client) (*api.Secret, error) {
+	c := config.Config()
+
+	if c.VaultClientCert == "" || c.VaultClientKey == "" {
+		return nil, errors.New("cert auth needs a client certificate and key (env: WGVAM_VAULT_CLIENT_CERT, WGVAM_VAULT_CLIENT_KEY)")
+	}
+
+	mount := c.VaultAuthMount
+	if mount == "" {
+		mount = "cert"
+	}
+
+	// role is optional, vault picks a matching one otherwise
+	data := map[string]interface{}{}
+	if c.VaultAuthRole != "" {
+		data["name"] = c.VaultAuthRole
+	}
+
+	return client.Logical().Write(fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/")), data)
+}
+
+// authenticate sets the client token, either statically from
+// the configuration or by logging in using an auth method.
+// Tokens from a login are renewed in the background.
+func (vc *Context) authenticate() error {
+	c := config.Config()
+
+	if c.VaultAuth == "" || c.VaultAuth == "token" {
+		vc.setToken(c.VaultToken)
+		return nil
+	}
+
+	login, ok := loginFuncs[c.VaultAuth]
+	if !ok {
+		return fmt.Errorf("unsupported vault auth method: %s", c.VaultAuth)
+	}
+
+	secret, err := vc.login(login)
+	if err != nil {
+		return err
+	}
+
+	go vc.watchToken(secret, login)
+
+	return nil
+}
+
+// login authenticates and sets the resulting client token. The login uses
+// a separate client, so that requests running at the same time keep using
+// the current token until the new one is set.
+func (vc *Context) login(login loginFunc) (*api.Secret, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	// login requests must not carry a (stale) token
+	client.ClearToken()
+
+	secret, err := login(client)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("vault login did not return a client token")
+	}
+	vc.setToken(secret.Auth.ClientToken)
+
+	log.WithFields(log.Fields{
+		"method":    config.Config().VaultAuth,
+		"ttl":       secret.Auth.LeaseDuration,
+		"renewable": secret.Auth.Renewable,
+	}).Debug("Logged in to vault")
+
+	return secret, nil
+}
+
+// watchToken renews the token of secret for as long as possible. When renewal
+// fails or the token reaches its max ttl, it logs in again.
+func (vc *Context) watchToken(secret *api.Secret, login loginFunc) {
+	for {
+		if secret.Auth.Renewable {
+			renewer, err := vc.client.NewRenewer(&api.RenewerInput{
+				Secret: secret,
+			})
+			if err != nil {
+				log.WithError(err).Warn("Unable to renew vault token")
+			} else {
+				vc.renewUntilDone(renewer)
+			}
+		} else {
+			// wait until token is about to expire
+			ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+			if ttl <= 0 {
+				// does not expire
+				return
+			}
+			<-time.After(ttl * 4 / 5)
+		}
+
+		// log in again, retry until successful
+		backoff := minReloginBackoff
+		for {
+			var err error
+			secret, err = vc.login(login)
+			if err == nil {
+				break
+			}
+			log.WithError(err).WithField("retryIn", backoff).Error("Unable to log in to vault again")
+			<-time.After(backoff)
+			backoff *= 2
+			if backoff > maxReloginBackoff {
+				backoff = maxReloginBackoff
+			}
+		}
+	}
+}
+
+// renewUntilDone runs renewer until renewal fails or the token
+// cannot be renewed any further
+func (vc *Context) renewUntilDone(renewer *api.Renewer) {
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	for {
+		select {
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				log.WithError(err).Warn("Unable to renew vault token, logging in again")
+			} else {
+				log.Debug("Vault token reached its max ttl, logging in again")
+			}
+			return
+		case renewal := <-renewer.RenewCh():
+			log.WithField("at", renewal.RenewedAt).Debug("Renewed vault token")
+		}
+	}
+}
@@ -8,40 +8,43 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// Create accesses vault to create the mesh namework data
-func (vc *Context) Create(name string, networkCidr string) (bool, error) {
-
-	mi := model.MeshInfo{
-		Name:        name,
-		NetworkCIDR: networkCidr,
-	}
+// CreateMeetingPoint accesses vault to create the mesh namework data
+func (vc *Context) CreateMeetingPoint(mi model.MeshInfo) (bool, error) {
 	log.WithField("meshinfo", mi).Trace("dump")
 
-	l := vc.Logical()
+	if mi.Namespace != "" && mi.Namespace != vc.namespace(mi.Name) {
+		if err := vc.PinNamespace(mi.Name, mi.Namespace); err != nil {
+			return false, err
+		}
+	}
 
-	p := DataPath(name, "mp")
-	log.WithField("path", p).Trace("Looking for meeting point")
+	log.WithField("path", vc.dataPath(mi.Name, "mp")).Trace("Looking for meeting point")
 
-	s, err := l.Read(p)
+	d, err := vc.kvRead(mi.Name, "mp")
 	if err != nil {
 		log.WithError(err).Error("Error reading from vault. Please check address and token.")
 		return false, err
 	}
-	if s == nil || s.Data["data"] == nil {
+	if d == nil {
 		// Not there, create.
-		body, err := json.Marshal(mi)
-		data := map[string]interface{}{
-			"data": map[string]interface{}{
-				"meshinfo": string(body),
-			},
-			"metadata": map[string]interface{}{},
+		if mi.TransitKey != "" {
+			if err := vc.createTransitKey(mi.Name, mi.TransitKey); err != nil {
+				log.WithError(err).Error("Error creating transit key. Please check that the transit secrets engine is enabled.")
+				return false, err
+			}
 		}
+		body, err := json.Marshal(mi)
 		if err != nil {
 			log.WithError(err).Error("Error marshaling data")
 			return false, err
 		}
-		log.WithField("data", data).Trace("writing to vault")
-		s, err = l.Write(p, data)
+		err = vc.kvCreate(mi.Name, "mp", map[string]interface{}{
+			"meshinfo": string(body),
+		})
+		if err == errKeyExists {
+			// created concurrently
+			return false, nil
+		}
 		if err != nil {
 			log.WithError(err).Error("Error writing to vault. Please check address and token.")
 			return false, err
@@ -50,8 +53,7 @@ func (vc *Context) Create(name string, networkCidr string) (bool, error) {
 		return true, nil
 	}
 
-	datadata := (s.Data["data"]).(map[string]interface{})
-	body := datadata["meshinfo"].(string)
+	body := d["meshinfo"].(string)
 
 	mi2 := &model.MeshInfo{}
 	err = json.Unmarshal([]byte(body), mi2)
@@ -3,56 +3,26 @@ package vault
 import (
 	"fmt"
 
-	"github.com/aschmidt75/wireguard-vault-automesh/model"
-
 	log "github.com/sirupsen/logrus"
 )
 
-// Delete accesses vault to delete the mesh and all its node data
-func (vc *Context) Delete(name string) (bool, error) {
-
-	mi := model.MeshInfo{
-		Name: name,
-	}
-	log.WithField("meshinfo", mi).Trace("dump")
-
-	l := vc.Logical()
-
-	p := DataPath(name, "mp")
-	log.WithField("path", p).Trace("Looking for meeting point")
+// DeleteMeetingPoint accesses vault to delete the meeting point data of a mesh
+func (vc *Context) DeleteMeetingPoint(name string) (bool, error) {
+	log.WithField("path", vc.dataPath(name, "mp")).Trace("Looking for meeting point")
 
-	s, err := l.Read(p)
+	d, err := vc.kvRead(name, "mp")
 	if err != nil {
 		log.WithError(err).Error("Error reading from vault. Please check address and token.")
 		return false, err
 	}
 
-	if s == nil || s.Data["data"] == nil {
+	if d == nil {
 		log.Debug("No meeting point for named mesh")
 		return false, nil
 	}
 
-	nodes, err := vc.ReadNodes(name)
-	if err != nil {
-		log.WithError(err).Error("Error reading from vault. Please check address and token")
-		return false, err
-	}
-	log.WithField("nodes", nodes).Debugf("Found %d nodes", len(nodes))
-
-	for nodeKey := range nodes {
-		if err := vc.DeleteNode(name, nodeKey); err != nil {
-			log.WithError(err).Error("Unable to delete node")
-			return false, err
-		}
-	}
-
 	// delete mp
-	_, err = vc.Logical().Delete(p)
-	if err != nil {
-		return false, err
-	}
-	_, err = vc.Logical().Delete(MetaDataPath(name, "mp"))
-	if err != nil {
+	if err := vc.kvDelete(name, "mp"); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -60,10 +30,5 @@ func (vc *Context) Delete(name string) (bool, error) {
 
 // DeleteNode deletes the node data and metadata, indicated by nodeID and meshName
 func (vc *Context) DeleteNode(meshName string, nodeID string) error {
-	_, err := vc.Logical().Delete(DataPath(meshName, fmt.Sprintf("nodes/%s", nodeID)))
-	if err != nil {
-		return err
-	}
-	_, err = vc.Logical().Delete(MetaDataPath(meshName, fmt.Sprintf("nodes/%s", nodeID)))
-	return err
+	return vc.kvDelete(meshName, fmt.Sprintf("nodes/%s", nodeID))
 }
@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	inviteMetaMesh   = "wgvam_mesh"
+	inviteMetaNodeID = "wgvam_node_id"
+)
+
+// Invite is the content of an unwrapped invitation
+type Invite struct {
+	Token    string
+	MeshName string
+	NodeID   string
+}
+
+// invitePolicyName returns the name of the policy created for
+// the invitation of nodeID
+func invitePolicyName(meshName, nodeID string) string {
+	return fmt.Sprintf("wgvam-%s-node-%s", meshName, nodeID)
+}
+
+// InviteRoleName returns the name of the token role admins of meshName
+// create invite tokens with
+func InviteRoleName(meshName string) string {
+	return fmt.Sprintf("wgvam-%s-invite", meshName)
+}
+
+// WriteInviteRole creates the token role for invites to meshName. Tokens
+// of the role may only carry the node policies of invites, so that admins
+// can create them without holding these policies themselves.
+func (vc *Context) WriteInviteRole(meshName string) error {
+	_, err := vc.logical(meshName).Write(fmt.Sprintf("auth/token/roles/%s", InviteRoleName(meshName)), map[string]interface{}{
+		"allowed_policies_glob": []string{invitePolicyName(meshName, "*")},
+	})
+	return err
+}
+
+// CreateInvite creates a policy scoped to the node entry of nodeID and
+// a token with that policy using the invite token role, valid for tokenTTL.
+// The token is returned response-wrapped, so it can only be unwrapped once
+// within wrapTTL.
+func (vc *Context) CreateInvite(meshName, nodeID string, wrapTTL, tokenTTL time.Duration) (string, error) {
+	policyName := invitePolicyName(meshName, nodeID)
+	if err := vc.WritePolicy(meshName, policyName, vc.nodePolicy(meshName, nodeID)); err != nil {
+		return "", err
+	}
+
+	vc.lock.RLock()
+	client, ok := vc.meshClients[meshName]
+	if !ok {
+		client = vc.client
+	}
+	vc.lock.RUnlock()
+
+	wrappingClient, err := client.Clone()
+	if err != nil {
+		return "", err
+	}
+	wrappingClient.SetToken(client.Token())
+	wrappingClient.SetHeaders(client.Headers())
+	wrappingClient.SetWrappingLookupFunc(func(operation, path string) string {
+		return wrapTTL.String()
+	})
+
+	s, err := wrappingClient.Logical().Write(fmt.Sprintf("auth/token/create/%s", InviteRoleName(meshName)), map[string]interface{}{
+		"policies":     []string{policyName},
+		"ttl":          tokenTTL.String(),
+		"display_name": fmt.Sprintf("wgvam-%s-%s", meshName, nodeID),
+		"meta": map[string]interface{}{
+			inviteMetaMesh:   meshName,
+			inviteMetaNodeID: nodeID,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if s == nil || s.WrapInfo == nil || s.WrapInfo.Token == "" {
+		return "", errors.New("vault did not return a wrapped token")
+	}
+
+	log.WithFields(log.Fields{
+		"accessor": s.WrapInfo.Accessor,
+		"ttl":      s.WrapInfo.TTL,
+	}).Debug("Created invite")
+
+	return s.WrapInfo.Token, nil
+}
+
+// RedeemInvite unwraps an invitation created by CreateInvite. This works
+// only once, subsequent calls fail. If meshName is given and pinned to a
+// namespace, the invite is unwrapped within that namespace.
+func RedeemInvite(wrappingToken, meshName string) (*Invite, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	client.ClearToken()
+
+	meshNamespaces, err := parseMeshNamespaces(config.Config().VaultMeshNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	if namespace, ok := meshNamespaces[meshName]; ok {
+		client.SetNamespace(namespace)
+	}
+
+	s, err := client.Logical().Unwrap(wrappingToken)
+	if err != nil {
+		return nil, err
+	}
+	return inviteFromSecret(s)
+}
+
+// inviteFromSecret reads token, mesh name and node id from an unwrapped secret
+func inviteFromSecret(s *api.Secret) (*Invite, error) {
+	if s == nil || s.Auth == nil || s.Auth.ClientToken == "" {
+		return nil, errors.New("invite does not contain a token")
+	}
+	res := &Invite{
+		Token:    s.Auth.ClientToken,
+		MeshName: s.Auth.Metadata[inviteMetaMesh],
+		NodeID:   s.Auth.Metadata[inviteMetaNodeID],
+	}
+	if res.MeshName == "" || res.NodeID == "" {
+		return nil, errors.New("invite is missing mesh name or node id")
+	}
+	return res, nil
+}
@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ registry.IPReservationTimes = &Context{}
+
+// ipPath returns the subkey under which the reservation for ip is stored
+func ipPath(ip string) string {
+	return fmt.Sprintf("ips/%s", ip)
+}
+
+// isCASConflict checks if err is vault's response to a failed check-and-set write
+func isCASConflict(err error) bool {
+	respErr, ok := err.(*api.ResponseError)
+	if !ok || respErr.StatusCode != 400 {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// isPermissionDenied checks if err is vault's response to a request
+// not allowed by the token's policies
+func isPermissionDenied(err error) bool {
+	respErr, ok := err.(*api.ResponseError)
+	return ok && respErr.StatusCode == 403
+}
+
+// ReserveIP tries to reserve the overlay ip for nodeID within meshName. It uses
+// a check-and-set write so that only one node is able to create the reservation.
+// Returns true if the ip is reserved for nodeID (either by this call or before),
+// false if another node holds it. Nodes may only create reservations, so
+// overwriting an existing one is denied instead of failing the check-and-set.
+func (vc *Context) ReserveIP(meshName string, ip string, nodeID string) (bool, error) {
+	createErr := vc.kvCreate(meshName, ipPath(ip), map[string]interface{}{
+		"nodeID":     nodeID,
+		"reservedAt": time.Now().UTC().Format(time.RFC3339),
+	})
+	if createErr == nil {
+		log.WithFields(log.Fields{"ip": ip, "id": nodeID}).Debug("Reserved ip")
+		return true, nil
+	}
+	if createErr != errKeyExists && !isPermissionDenied(createErr) {
+		return false, createErr
+	}
+
+	// already reserved, check if it's us
+	owner, err := vc.ReadIPOwner(meshName, ip)
+	if err != nil {
+		return false, err
+	}
+	if owner == "" {
+		// not reserved, so the write was denied for another reason
+		return false, createErr
+	}
+	log.WithFields(log.Fields{"ip": ip, "owner": owner}).Trace("ip already reserved")
+
+	return owner == nodeID, nil
+}
+
+// ReadIPOwner returns the ID of the node which reserved ip, or an empty
+// string if ip is not reserved.
+func (vc *Context) ReadIPOwner(meshName string, ip string) (string, error) {
+	d, err := vc.kvRead(meshName, ipPath(ip))
+	if err != nil || d == nil {
+		return "", err
+	}
+	owner, _ := d["nodeID"].(string)
+
+	return owner, nil
+}
+
+// ReadIPReservationTime returns the time ip has been reserved at. Returns the
+// zero time for reservations made before the time was recorded.
+func (vc *Context) ReadIPReservationTime(meshName string, ip string) (time.Time, error) {
+	d, err := vc.kvRead(meshName, ipPath(ip))
+	if err != nil || d == nil {
+		return time.Time{}, err
+	}
+	reservedAt, ok := d["reservedAt"].(string)
+	if !ok || reservedAt == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, reservedAt)
+}
+
+// ReleaseIP removes the reservation of ip. Metadata is deleted as well, so the
+// ip can be reserved again using check-and-set.
+func (vc *Context) ReleaseIP(meshName string, ip string) error {
+	return vc.kvDelete(meshName, ipPath(ip))
+}
+
+// ReadIPs lists all reserved ips of a mesh
+func (vc *Context) ReadIPs(meshName string) ([]string, error) {
+	return vc.kvList(meshName, "ips")
+}
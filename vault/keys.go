@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"fmt"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+)
+
+var _ registry.KeyStore = &Context{}
+
+// privateKeyPath returns the subkey under which the wireguard private key
+// of nodeID is stored. It is kept apart from nodes/, which all nodes can read.
+func privateKeyPath(nodeID string) string {
+	return fmt.Sprintf("keys/%s", nodeID)
+}
+
+// ReadPrivateKey reads the wireguard private key of nodeID. Returns ""
+// if there is none.
+func (vc *Context) ReadPrivateKey(meshName string, nodeID string) (string, error) {
+	d, err := vc.kvRead(meshName, privateKeyPath(nodeID))
+	if err != nil || d == nil {
+		return "", err
+	}
+	d, err = vc.decryptNodeData(meshName, d)
+	if err != nil {
+		return "", err
+	}
+	privateKey, _ := d["privateKey"].(string)
+	return privateKey, nil
+}
+
+// WritePrivateKey stores the wireguard private key of nodeID. It is
+// encrypted like node records if the mesh has a transit key.
+func (vc *Context) WritePrivateKey(meshName string, nodeID string, privateKey string) error {
+	data, err := vc.encryptNodeData(meshName, map[string]interface{}{
+		"privateKey": privateKey,
+	})
+	if err != nil {
+		return err
+	}
+	return vc.kvWrite(meshName, privateKeyPath(nodeID), data)
+}
+
+// DeletePrivateKey deletes the wireguard private key of nodeID
+func (vc *Context) DeletePrivateKey(meshName string, nodeID string) error {
+	return vc.kvDelete(meshName, privateKeyPath(nodeID))
+}
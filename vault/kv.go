@@ -0,0 +1,262 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// errKeyExists is returned by kvCreate if the key is already present,
+// and by kvWriteCAS if the key does not have the expected version
+var errKeyExists = errors.New("key already exists")
+
+// enginePath returns the configured path of the secrets engine without slashes
+func enginePath() string {
+	return strings.Trim(config.Config().VaultEnginePath, "/")
+}
+
+// kvVersionOf returns the version of the secrets engine within the namespace
+// of a mesh. Unless configured, it is detected once per namespace.
+func (vc *Context) kvVersionOf(meshName string) int {
+	if vc.kvVersion != 0 {
+		return vc.kvVersion
+	}
+	namespace := vc.namespace(meshName)
+
+	vc.lock.RLock()
+	version, ok := vc.kvVersions[namespace]
+	vc.lock.RUnlock()
+	if ok {
+		return version
+	}
+
+	version = vc.detectKVVersion(meshName)
+	log.WithFields(log.Fields{
+		"version":   version,
+		"namespace": namespace,
+	}).Trace("kv secrets engine")
+	if version == 1 {
+		warnKVVersion1()
+	}
+
+	vc.lock.Lock()
+	vc.kvVersions[namespace] = version
+	vc.lock.Unlock()
+	return version
+}
+
+var warnKVVersion1Once sync.Once
+
+// warnKVVersion1 warns about the missing check-and-set of version 1 engines,
+// once per process
+func warnKVVersion1() {
+	warnKVVersion1Once.Do(func() {
+		log.Warn("kv secrets engine is version 1, which has no check-and-set. Concurrent writes, e.g. of nodes joining at the same time, may overwrite each other.")
+	})
+}
+
+// detectKVVersion looks up the version of the secrets engine within the
+// namespace of a mesh, using the preflight endpoint of vault's kv cli first
+// (which works for all tokens with access to the engine) and sys/mounts
+// second. Defaults to version 2.
+func (vc *Context) detectKVVersion(meshName string) int {
+	mount := enginePath() + "/"
+	client := vc.meshClient(meshName)
+
+	var options map[string]interface{}
+	s, err := client.Logical().Read("sys/internal/ui/mounts/" + mount)
+	if err == nil && s != nil {
+		options, _ = s.Data["options"].(map[string]interface{})
+	} else {
+		log.WithError(err).Trace("Unable to query kv mount, trying sys/mounts")
+
+		mounts, err := client.Sys().ListMounts()
+		if err != nil {
+			log.WithError(err).Debug("Unable to detect kv version of secrets engine, assuming version 2")
+			return 2
+		}
+		m, ok := mounts[mount]
+		if !ok {
+			log.WithField("path", mount).Debug("Secrets engine not found in sys/mounts, assuming kv version 2")
+			return 2
+		}
+		options = make(map[string]interface{})
+		for k, v := range m.Options {
+			options[k] = v
+		}
+	}
+
+	if v, _ := options["version"].(string); v == "1" {
+		return 1
+	}
+	if options["version"] == nil {
+		// mounts without a version option are version 1
+		return 1
+	}
+	return 2
+}
+
+// dataPath returns the path to read and write the key p of a mesh
+func (vc *Context) dataPath(meshName, p string) string {
+	if vc.kvVersionOf(meshName) == 1 {
+		return fmt.Sprintf("%s/%s/%s", enginePath(), meshName, p)
+	}
+	return DataPath(meshName, p)
+}
+
+// listPath returns the path to list the keys below p of a mesh
+func (vc *Context) listPath(meshName, p string) string {
+	if vc.kvVersionOf(meshName) == 1 {
+		return fmt.Sprintf("%s/%s/%s", enginePath(), meshName, p)
+	}
+	return MetaDataPath(meshName, p)
+}
+
+// rootListPath returns the path to list all meshes
+func (vc *Context) rootListPath() string {
+	if vc.kvVersionOf("") == 1 {
+		return fmt.Sprintf("%s/", enginePath())
+	}
+	return MetaDataRootPath()
+}
+
+// kvRead reads the data of key p of a mesh. Returns nil if the key is not present.
+func (vc *Context) kvRead(meshName, p string) (map[string]interface{}, error) {
+	s, err := vc.logical(meshName).Read(vc.dataPath(meshName, p))
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.Data == nil {
+		return nil, nil
+	}
+	if vc.kvVersionOf(meshName) == 1 {
+		return s.Data, nil
+	}
+	if s.Data["data"] == nil {
+		// deleted version
+		return nil, nil
+	}
+	return s.Data["data"].(map[string]interface{}), nil
+}
+
+// kvWrite writes data to key p of a mesh
+func (vc *Context) kvWrite(meshName, p string, data map[string]interface{}) error {
+	log.WithField("data", data).Trace("writing to vault")
+
+	if vc.kvVersionOf(meshName) == 1 {
+		_, err := vc.logical(meshName).Write(vc.dataPath(meshName, p), data)
+		return err
+	}
+	_, err := vc.logical(meshName).Write(vc.dataPath(meshName, p), map[string]interface{}{
+		"data": data,
+	})
+	return err
+}
+
+// kvCreate writes data to key p of a mesh only if the key is not present yet,
+// otherwise it returns errKeyExists. With version 2 this uses a check-and-set write.
+// Version 1 does not support check-and-set, so concurrent creates of the same key
+// may both succeed there.
+func (vc *Context) kvCreate(meshName, p string, data map[string]interface{}) error {
+	return vc.kvWriteCAS(meshName, p, data, 0)
+}
+
+// kvReadVersion reads the data of key p of a mesh along with its version, which
+// can be passed to kvWriteCAS. Version 1 engines do not keep versions, there
+// the version is 1 for all present keys.
+func (vc *Context) kvReadVersion(meshName, p string) (map[string]interface{}, int, error) {
+	if vc.kvVersionOf(meshName) == 1 {
+		d, err := vc.kvRead(meshName, p)
+		if err != nil || d == nil {
+			return nil, 0, err
+		}
+		return d, 1, nil
+	}
+
+	s, err := vc.logical(meshName).Read(vc.dataPath(meshName, p))
+	if err != nil {
+		return nil, 0, err
+	}
+	if s == nil || s.Data["data"] == nil {
+		return nil, 0, nil
+	}
+	version := 0
+	if md, ok := s.Data["metadata"].(map[string]interface{}); ok {
+		if v, ok := md["version"].(json.Number); ok {
+			v64, err := v.Int64()
+			if err != nil {
+				return nil, 0, err
+			}
+			version = int(v64)
+		}
+	}
+	return s.Data["data"].(map[string]interface{}), version, nil
+}
+
+// kvWriteCAS writes data to key p of a mesh only if the key still has the
+// given version (0: not present), otherwise it returns errKeyExists. See
+// kvCreate for version 1 engines.
+func (vc *Context) kvWriteCAS(meshName, p string, data map[string]interface{}, version int) error {
+	log.WithFields(log.Fields{"data": data, "cas": version}).Trace("writing to vault")
+
+	if vc.kvVersionOf(meshName) == 1 {
+		_, current, err := vc.kvReadVersion(meshName, p)
+		if err != nil {
+			return err
+		}
+		if current != version {
+			return errKeyExists
+		}
+		_, err = vc.logical(meshName).Write(vc.dataPath(meshName, p), data)
+		return err
+	}
+
+	_, err := vc.logical(meshName).Write(vc.dataPath(meshName, p), map[string]interface{}{
+		"options": map[string]interface{}{
+			"cas": version,
+		},
+		"data": data,
+	})
+	if isCASConflict(err) {
+		return errKeyExists
+	}
+	return err
+}
+
+// kvList lists the keys below p of a mesh. Subfolders have a trailing slash.
+func (vc *Context) kvList(meshName, p string) ([]string, error) {
+	s, err := vc.logical(meshName).List(vc.listPath(meshName, p))
+	if err != nil {
+		return nil, err
+	}
+	return keysFromSecretData(s), nil
+}
+
+// kvDelete deletes key p of a mesh. With version 2, metadata and all
+// versions are deleted as well, so the key can be created again.
+func (vc *Context) kvDelete(meshName, p string) error {
+	_, err := vc.logical(meshName).Delete(vc.dataPath(meshName, p))
+	if err != nil || vc.kvVersionOf(meshName) == 1 {
+		return err
+	}
+	_, err = vc.logical(meshName).Delete(MetaDataPath(meshName, p))
+	return err
+}
+
+// keysFromSecretData returns the keys of a list response
+func keysFromSecretData(s *api.Secret) []string {
+	res := make([]string, 0)
+	if s == nil || s.Data["keys"] == nil {
+		return res
+	}
+	for _, key := range s.Data["keys"].([]interface{}) {
+		res = append(res, key.(string))
+	}
+	return res
+}
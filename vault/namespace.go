@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// parseMeshNamespaces parses a list of <mesh>=<namespace> pairs,
+// separated by comma
+func parseMeshNamespaces(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid mesh namespace %q, must be <mesh>=<namespace>", pair)
+		}
+		res[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), "/")
+	}
+	return res, nil
+}
+
+// PinNamespace makes all requests for the given mesh use namespace
+// instead of the client's default namespace
+func (vc *Context) PinNamespace(meshName, namespace string) error {
+	client, err := vc.client.Clone()
+	if err != nil {
+		return err
+	}
+	client.SetNamespace(namespace)
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	client.SetToken(vc.client.Token())
+	vc.meshClients[meshName] = client
+	vc.meshNamespaces[meshName] = namespace
+
+	log.WithFields(log.Fields{
+		"mesh":      meshName,
+		"namespace": namespace,
+	}).Trace("Pinned namespace")
+
+	return nil
+}
+
+// namespace returns the namespace pinned for a mesh, or
+// an empty string if the default namespace is used
+func (vc *Context) namespace(meshName string) string {
+	vc.lock.RLock()
+	defer vc.lock.RUnlock()
+
+	return vc.meshNamespaces[meshName]
+}
+
+// logical returns the api.Logical to access paths of the given mesh,
+// within the mesh's namespace if one is pinned
+func (vc *Context) logical(meshName string) *api.Logical {
+	return vc.meshClient(meshName).Logical()
+}
+
+// meshClient returns the client to access the given mesh, within
+// the mesh's namespace if one is pinned
+func (vc *Context) meshClient(meshName string) *api.Client {
+	vc.lock.RLock()
+	defer vc.lock.RUnlock()
+
+	if client, ok := vc.meshClients[meshName]; ok {
+		return client
+	}
+	return vc.client
+}
+
+// setToken sets token for the client and all clients of
+// pinned namespaces. An empty token clears them.
+func (vc *Context) setToken(token string) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	if token != "" {
+		vc.client.SetToken(token)
+	} else {
+		vc.client.ClearToken()
+	}
+	for _, client := range vc.meshClients {
+		if token != "" {
+			client.SetToken(token)
+		} else {
+			client.ClearToken()
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Roles for which policies can be generated
+const (
+	PolicyRoleAdmin  = "admin"
+	PolicyRoleMember = "member"
+	PolicyRoleReader = "reader"
+)
+
+// memberIDTemplate is the vault policy template resolving to the name of
+// the requesting entity, which is used as node id by members
+const memberIDTemplate = "{{identity.entity.name}}"
+
+// policyRules collects capabilities per path, keeping paths in order
+type policyRules struct {
+	paths        []string
+	capabilities map[string][]string
+}
+
+func newPolicyRules() *policyRules {
+	return &policyRules{
+		capabilities: make(map[string][]string),
+	}
+}
+
+// add grants capabilities on path
+func (r *policyRules) add(path string, capabilities ...string) {
+	path = strings.TrimPrefix(path, "/")
+	if _, ok := r.capabilities[path]; !ok {
+		r.paths = append(r.paths, path)
+	}
+	for _, c := range capabilities {
+		if !containsString(r.capabilities[path], c) {
+			r.capabilities[path] = append(r.capabilities[path], c)
+		}
+	}
+}
+
+// HCL renders the rules as an ACL policy, with comment on top
+func (r *policyRules) HCL(comment string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", comment)
+	for _, path := range r.paths {
+		fmt.Fprintf(&b, "\npath \"%s\" {\n  capabilities = [\"%s\"]\n}\n", path, strings.Join(r.capabilities[path], "\", \""))
+	}
+	return b.String()
+}
+
+// nodePolicy returns an ACL policy which allows a single node to join meshName,
+// i.e. to read the meeting point and all nodes, to write its own node entry and
+// to reserve and release ips.
+func (vc *Context) nodePolicy(meshName, nodeID string) string {
+	r := newPolicyRules()
+
+	r.add(vc.dataPath(meshName, "mp"), "read")
+
+	r.add(vc.listPath(meshName, "nodes/"), "list")
+	r.add(vc.dataPath(meshName, "nodes/*"), "read")
+	r.add(vc.dataPath(meshName, "nodes/"+nodeID), "create", "read", "update", "delete")
+	r.add(vc.listPath(meshName, "nodes/"+nodeID), "delete")
+
+	// signers may only be created, not replaced
+	r.add(vc.listPath(meshName, "signers/"), "list")
+	r.add(vc.dataPath(meshName, "signers/*"), "read")
+	r.add(vc.dataPath(meshName, "signers/"+nodeID), "create", "read", "delete")
+	r.add(vc.listPath(meshName, "signers/"+nodeID), "delete")
+
+	// preshared keys of pairs this node is part of, stored at psk/<lower id>/<higher id>
+	r.add(vc.listPath(meshName, "psk/"), "list")
+	r.add(vc.listPath(meshName, "psk/+/"), "list")
+	r.add(vc.dataPath(meshName, "psk/"+nodeID+"/*"), "create", "read", "update", "delete")
+	r.add(vc.dataPath(meshName, "psk/+/"+nodeID), "create", "read", "update", "delete")
+	r.add(vc.listPath(meshName, "psk/"+nodeID+"/*"), "delete")
+	r.add(vc.listPath(meshName, "psk/+/"+nodeID), "delete")
+
+	// the node's own wireguard private key, if kept in vault
+	r.add(vc.dataPath(meshName, "keys/"+nodeID), "create", "read", "update", "delete")
+	r.add(vc.listPath(meshName, "keys/"+nodeID), "delete")
+
+	// ip reservations may only be created, so that nodes cannot take over
+	// or release the ips of others. Releases are left to prune.
+	r.add(vc.listPath(meshName, "ips/"), "list")
+	r.add(vc.dataPath(meshName, "ips/*"), "create", "read")
+
+	// node records of meshes created with --encrypt
+	r.add(transitPath(fmt.Sprintf("encrypt/%s", TransitKeyName(meshName))), "update")
+	r.add(transitPath(fmt.Sprintf("decrypt/%s", TransitKeyName(meshName))), "update")
+
+	return r.HCL(fmt.Sprintf("wireguard-vault-automesh: node %s of mesh %s", nodeID, meshName))
+}
+
+// PolicyName returns the default name of the policy for role within meshName
+func PolicyName(meshName, role string) string {
+	return fmt.Sprintf("wgvam-%s-%s", meshName, role)
+}
+
+// Policy returns the minimal ACL policy in HCL for the given role:
+// admins may create, delete and invite to meshName, members may join using
+// their entity name as node id, readers may only read the mesh.
+func (vc *Context) Policy(meshName, role string) (string, error) {
+	switch role {
+	case PolicyRoleAdmin:
+		return vc.adminPolicy(meshName), nil
+	case PolicyRoleMember:
+		return vc.nodePolicy(meshName, memberIDTemplate), nil
+	case PolicyRoleReader:
+		return vc.readerPolicy(meshName), nil
+	}
+	return "", fmt.Errorf("unknown role %q, must be one of %s, %s, %s", role, PolicyRoleAdmin, PolicyRoleMember, PolicyRoleReader)
+}
+
+// WritePolicy stores policy as ACL policy named name. It is written to the
+// namespace of meshName if one is pinned.
+func (vc *Context) WritePolicy(meshName, name, policy string) error {
+	log.WithField("policy", policy).Trace("writing policy")
+
+	_, err := vc.logical(meshName).Write(fmt.Sprintf("sys/policies/acl/%s", name), map[string]interface{}{
+		"policy": policy,
+	})
+	return err
+}
+
+// adminPolicy returns an ACL policy which allows to manage all data of
+// meshName and to create invites for it
+func (vc *Context) adminPolicy(meshName string) string {
+	r := newPolicyRules()
+
+	r.add(vc.rootListPath(), "list")
+	r.add(vc.dataPath(meshName, "*"), "create", "read", "update", "delete")
+	r.add(vc.listPath(meshName, "*"), "read", "delete", "list")
+	// preshared keys are only readable by the pair of nodes,
+	// private keys only by the node itself
+	r.add(vc.dataPath(meshName, "psk/*"), "delete", "list")
+	r.add(vc.dataPath(meshName, "keys/*"), "delete", "list")
+
+	// node records of meshes created with --encrypt
+	r.add(transitPath(fmt.Sprintf("keys/%s", TransitKeyName(meshName))), "create", "update")
+	r.add(transitPath(fmt.Sprintf("encrypt/%s", TransitKeyName(meshName))), "update")
+	r.add(transitPath(fmt.Sprintf("decrypt/%s", TransitKeyName(meshName))), "update")
+
+	// invites, tokens are created using a role restricted to the node policies
+	r.add(fmt.Sprintf("sys/policies/acl/%s", invitePolicyName(meshName, "*")), "create", "update")
+	r.add(fmt.Sprintf("auth/token/create/%s", InviteRoleName(meshName)), "create", "update")
+
+	return r.HCL(fmt.Sprintf("wireguard-vault-automesh: admin of mesh %s", meshName))
+}
+
+// readerPolicy returns an ACL policy which allows to read the meeting
+// point and all nodes of meshName
+func (vc *Context) readerPolicy(meshName string) string {
+	r := newPolicyRules()
+
+	r.add(vc.rootListPath(), "list")
+	r.add(vc.dataPath(meshName, "*"), "read")
+	r.add(vc.listPath(meshName, "*"), "list")
+
+	// preshared keys are only readable by the pair of nodes,
+	// private keys only by the node itself
+	r.add(vc.dataPath(meshName, "psk/*"), "deny")
+	r.add(vc.dataPath(meshName, "keys/*"), "deny")
+
+	// node records of meshes created with --encrypt
+	r.add(transitPath(fmt.Sprintf("decrypt/%s", TransitKeyName(meshName))), "update")
+
+	return r.HCL(fmt.Sprintf("wireguard-vault-automesh: reader of mesh %s", meshName))
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ registry.PSKStore = &Context{}
+
+// pskPath returns the subkey under which the preshared key of a pair of
+// nodes is stored. The pair is ordered, so both nodes use the same path.
+func pskPath(nodeA, nodeB string) string {
+	if nodeB < nodeA {
+		nodeA, nodeB = nodeB, nodeA
+	}
+	return fmt.Sprintf("psk/%s/%s", nodeA, nodeB)
+}
+
+// ReadPSK reads the preshared key of the pair nodeA, nodeB. Returns nil
+// if there is none.
+func (vc *Context) ReadPSK(meshName string, nodeA string, nodeB string) (*model.PSK, error) {
+	d, version, err := vc.kvReadVersion(meshName, pskPath(nodeA, nodeB))
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	res := &model.PSK{
+		Version: version,
+	}
+	res.Key, _ = d["psk"].(string)
+	if created, ok := d["created"].(string); ok {
+		if res.Created, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, err
+		}
+	}
+	// optional, only present while a rotation is staged
+	res.Next, _ = d["next"].(string)
+	if activation, ok := d["activation"].(string); ok && activation != "" {
+		if res.Activation, err = time.Parse(time.RFC3339, activation); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// WritePSK writes the preshared key of the pair nodeA, nodeB using a
+// check-and-set write on psk.Version. Returns false if the key has been
+// written by the other node in the meantime.
+func (vc *Context) WritePSK(meshName string, nodeA string, nodeB string, psk model.PSK) (bool, error) {
+	d := map[string]interface{}{
+		"psk":     psk.Key,
+		"created": psk.Created.UTC().Format(time.RFC3339),
+	}
+	if psk.Next != "" {
+		d["next"] = psk.Next
+		d["activation"] = psk.Activation.UTC().Format(time.RFC3339)
+	}
+	err := vc.kvWriteCAS(meshName, pskPath(nodeA, nodeB), d, psk.Version)
+	if err == errKeyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{"a": nodeA, "b": nodeB}).Debug("Wrote preshared key")
+	return true, nil
+}
+
+// DeletePSKs deletes the preshared keys of all pairs nodeID is part of
+func (vc *Context) DeletePSKs(meshName string, nodeID string) error {
+	lows, err := vc.kvList(meshName, "psk")
+	if err != nil {
+		return err
+	}
+	for _, low := range lows {
+		low = strings.TrimSuffix(low, "/")
+
+		highs, err := vc.kvList(meshName, fmt.Sprintf("psk/%s", low))
+		if err != nil {
+			return err
+		}
+		for _, high := range highs {
+			if low != nodeID && high != nodeID {
+				continue
+			}
+			if err := vc.kvDelete(meshName, pskPath(low, high)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
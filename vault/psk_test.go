@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeKV serves reads and writes of a kv secrets engine mounted at /wgvam,
+// including check-and-set writes of version 2.
+type fakeKV struct {
+	kvVersion int
+
+	mu       sync.Mutex
+	data     map[string]map[string]interface{}
+	versions map[string]int
+}
+
+func newFakeVault(t *testing.T, kvVersion int) *Context {
+	kv := &fakeKV{
+		kvVersion: kvVersion,
+		data:      make(map[string]map[string]interface{}),
+		versions:  make(map[string]int),
+	}
+	srv := httptest.NewServer(kv)
+	t.Cleanup(srv.Close)
+
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+	return &Context{
+		client:          client,
+		kvVersion:       kvVersion,
+		meshClients:     make(map[string]*api.Client),
+		meshNamespaces:  make(map[string]string),
+		kvVersions:      make(map[string]int),
+		meshTransitKeys: make(map[string]string),
+	}
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/wgvam/")
+	if kv.kvVersion == 2 {
+		key = strings.TrimPrefix(key, "data/")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		d, ok := kv.data[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if kv.kvVersion == 1 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": d})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     d,
+				"metadata": map[string]interface{}{"version": kv.versions[key]},
+			},
+		})
+	case http.MethodPut, http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if kv.kvVersion == 1 {
+			kv.data[key] = body
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if options, ok := body["options"].(map[string]interface{}); ok {
+			if cas, ok := options["cas"].(float64); ok && int(cas) != kv.versions[key] {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"errors": []string{"check-and-set parameter did not match the current version"},
+				})
+				return
+			}
+		}
+		d, _ := body["data"].(map[string]interface{})
+		kv.data[key] = d
+		kv.versions[key]++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"version": kv.versions[key]},
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWritePSK(t *testing.T) {
+	created := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		exists  bool
+		version func(read int) int
+		want    bool
+	}{
+		{"create with version 0", false, func(int) int { return 0 }, true},
+		{"create over existing key", true, func(int) int { return 0 }, false},
+		{"update read version", true, func(read int) int { return read }, true},
+		{"update outdated version", true, func(read int) int { return read - 1 }, false},
+	}
+
+	for _, kvVersion := range []int{1, 2} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("kv%d %s", kvVersion, tt.name), func(t *testing.T) {
+				vc := newFakeVault(t, kvVersion)
+
+				read := 0
+				if tt.exists {
+					ok, err := vc.WritePSK("mesh1", "n1", "n2", model.PSK{Key: "old", Created: created})
+					if err != nil || !ok {
+						t.Fatalf("WritePSK is %v, %v", ok, err)
+					}
+					psk, err := vc.ReadPSK("mesh1", "n2", "n1")
+					if err != nil || psk == nil {
+						t.Fatalf("ReadPSK is %v, %v", psk, err)
+					}
+					read = psk.Version
+				}
+
+				got, err := vc.WritePSK("mesh1", "n2", "n1", model.PSK{Key: "new", Created: created, Version: tt.version(read)})
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if got != tt.want {
+					t.Errorf("WritePSK is %v, want %v", got, tt.want)
+				}
+
+				psk, err := vc.ReadPSK("mesh1", "n1", "n2")
+				if err != nil || psk == nil {
+					t.Fatalf("ReadPSK is %v, %v", psk, err)
+				}
+				wantKey := "old"
+				if tt.want {
+					wantKey = "new"
+				}
+				if psk.Key != wantKey {
+					t.Errorf("key is %q, want %q", psk.Key, wantKey)
+				}
+			})
+		}
+	}
+}
+
+func TestReadPSK(t *testing.T) {
+	vc := newFakeVault(t, 2)
+
+	psk, err := vc.ReadPSK("mesh1", "n1", "n2")
+	if err != nil || psk != nil {
+		t.Fatalf("ReadPSK of a missing key is %v, %v", psk, err)
+	}
+
+	want := model.PSK{
+		Key:        "key",
+		Created:    time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+		Next:       "next",
+		Activation: time.Date(2020, 5, 1, 12, 2, 0, 0, time.UTC),
+	}
+	if ok, err := vc.WritePSK("mesh1", "n1", "n2", want); err != nil || !ok {
+		t.Fatalf("WritePSK is %v, %v", ok, err)
+	}
+
+	psk, err = vc.ReadPSK("mesh1", "n2", "n1")
+	if err != nil || psk == nil {
+		t.Fatalf("ReadPSK is %v, %v", psk, err)
+	}
+	if psk.Key != want.Key || psk.Next != want.Next || psk.Version != 1 ||
+		!psk.Created.Equal(want.Created) || !psk.Activation.Equal(want.Activation) {
+		t.Errorf("got %+v, want %+v", *psk, want)
+	}
+}
@@ -2,33 +2,34 @@ package vault
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/model"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
 
 	log "github.com/sirupsen/logrus"
 )
 
 // ReadMeetingPoint accesses vault to read the mesh namework data from the meeting point
 func (vc *Context) ReadMeetingPoint(meshName string) (*model.MeshInfo, error) {
-	l := vc.Logical()
+	log.WithField("path", vc.dataPath(meshName, "mp")).Trace("Looking for meeting point")
 
-	p := DataPath(meshName, "mp")
-	log.WithField("path", p).Trace("Looking for meeting point")
-
-	s, err := l.Read(p)
+	d, err := vc.kvRead(meshName, "mp")
 	if err != nil {
 		log.WithError(err).Error("Error reading from vault. Please check address and token")
 		return nil, err
 	}
-	if s == nil || s.Data["data"] == nil {
+	if d == nil {
 		log.Error("No meeting point data found for given network name")
 		return nil, nil
 	}
 
-	datadata := (s.Data["data"]).(map[string]interface{})
-	body := datadata["meshinfo"].(string)
+	body := d["meshinfo"].(string)
 
 	mi2 := &model.MeshInfo{}
 	err = json.Unmarshal([]byte(body), mi2)
@@ -42,63 +43,94 @@ func (vc *Context) ReadMeetingPoint(meshName string) (*model.MeshInfo, error) {
 	return mi2, nil
 }
 
+// ListMeshes reads the names of all meshes within the secrets engine
+func (vc *Context) ListMeshes() ([]string, error) {
+	p := vc.rootListPath()
+	log.WithField("path", p).Trace("Looking for meshes...")
+
+	res := make([]string, 0)
+
+	s, err := vc.Logical().List(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range keysFromSecretData(s) {
+		// meshes are folders, listed with a trailing slash
+		if !strings.HasSuffix(name, "/") {
+			continue
+		}
+		res = append(res, strings.TrimSuffix(name, "/"))
+	}
+
+	// add meshes from pinned namespaces
+	vc.lock.RLock()
+	pinned := make([]string, 0, len(vc.meshNamespaces))
+	for meshName := range vc.meshNamespaces {
+		pinned = append(pinned, meshName)
+	}
+	vc.lock.RUnlock()
+	for _, meshName := range pinned {
+		if containsString(res, meshName) {
+			continue
+		}
+		d, err := vc.kvRead(meshName, "mp")
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			res = append(res, meshName)
+		}
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, e := range a {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 // ReadNodes reads the list of nodes from vault
 func (vc *Context) ReadNodes(meshName string) (model.NodeMap, error) {
-	l := vc.Logical()
-
-	p := MetaDataPath(meshName, "nodes")
-	log.WithField("path", p).Trace("Looking for nodes...")
+	log.WithField("path", vc.listPath(meshName, "nodes")).Trace("Looking for nodes...")
 
 	res := make(model.NodeMap, 0)
 
-	s, err := l.List(p)
+	keys, err := vc.kvList(meshName, "nodes")
 	if err != nil {
 		return nil, err
 	}
-	if s == nil {
-		return res, nil
-	}
-
-	keys := s.Data["keys"].([]interface{})
 
 	for _, key := range keys {
 
-		p = DataPath(meshName, fmt.Sprintf("nodes/%s", key.(string)))
-		v, err := l.Read(p)
+		d, err := vc.kvRead(meshName, fmt.Sprintf("nodes/%s", key))
 		if err != nil {
 			return res, err
 		}
 
-		if v.Data["data"] == nil {
-			log.Error("Internal error, node in vault is present but w/o data.")
-			return res, nil
+		if d == nil {
+			log.WithField("key", key).Error("Internal error, node in vault is present but w/o data.")
+			continue
+		}
+		d, err = vc.decryptNodeData(meshName, d)
+		if err != nil {
+			return res, err
 		}
-		d := v.Data["data"].(map[string]interface{})
 		log.WithField("d", d).Trace("ReadNodes.dump")
 
-		lp := 0
-		switch d["endpointPort"].(type) {
-		case json.Number:
-			lp0, err := d["endpointPort"].(json.Number).Int64()
-			if err != nil {
-				return res, err
-			}
-			lp = int(lp0)
-		case string:
-			lp, err = strconv.Atoi(d["endpointPort"].(string))
-			if err != nil {
-				return res, err
-			}
-		default:
-			log.Error("Unsupported typ")
-		}
-		res[key.(string)] = model.NodeInfo{
-			NodeID:             d["nodeID"].(string),
-			WireguardIP:        d["wgip"].(string),
-			WireguardPublicKey: d["pubkey"].(string),
-			ExternalIP:         d["endpointIP"].(string),
-			ListenPort:         int(lp),
+		nodeInfo, err := nodeInfoFromData(d)
+		if err != nil {
+			// a tampered entry must not keep all others from being read
+			log.WithError(err).WithField("key", key).Error("Skipping malformed node entry")
+			continue
 		}
+		res[key] = nodeInfo
 
 	}
 
@@ -107,35 +139,148 @@ func (vc *Context) ReadNodes(meshName string) (model.NodeMap, error) {
 
 // ReadNode reads a single node data from vault
 func (vc *Context) ReadNode(meshName, key string) (model.NodeInfo, error) {
-	l := vc.Logical()
-
-	p := MetaDataPath(meshName, "nodes")
-	log.WithField("path", p).Trace("Looking for nodes...")
+	p := vc.dataPath(meshName, fmt.Sprintf("nodes/%s", key))
+	log.WithField("path", p).Trace("Looking for node...")
 
 	res := model.NodeInfo{}
 
-	p = DataPath(meshName, fmt.Sprintf("nodes/%s", key))
-	v, err := l.Read(p)
+	d, err := vc.kvRead(meshName, fmt.Sprintf("nodes/%s", key))
 	if err != nil {
 		return res, err
 	}
-
-	if v.Data["data"] == nil {
-		log.Error("Internal error, node in vault is present but w/o data.")
+	if d == nil {
+		return res, registry.ErrNodeNotFound
+	}
+	d, err = vc.decryptNodeData(meshName, d)
+	if err != nil {
+		return res, err
 	}
-	d := v.Data["data"].(map[string]interface{})
 	log.WithField("d", d).Trace("ReadNode.dump")
 
-	lp, err := d["endpointPort"].(json.Number).Int64()
+	return nodeInfoFromData(d)
+}
+
+// ReadNodeVersion reads a single node along with the version of its entry
+func (vc *Context) ReadNodeVersion(meshName, key string) (model.NodeInfo, int, error) {
+	d, version, err := vc.kvReadVersion(meshName, fmt.Sprintf("nodes/%s", key))
+	if err != nil {
+		return model.NodeInfo{}, 0, err
+	}
+	if d == nil {
+		return model.NodeInfo{}, 0, registry.ErrNodeNotFound
+	}
+	d, err = vc.decryptNodeData(meshName, d)
+	if err != nil {
+		return model.NodeInfo{}, 0, err
+	}
+
+	res, err := nodeInfoFromData(d)
+	return res, version, err
+}
+
+// errMalformedNode is returned for node entries with missing or
+// mistyped fields
+var errMalformedNode = errors.New("malformed node entry")
+
+// requiredString returns the string field key of d
+func requiredString(d map[string]interface{}, key string) (string, error) {
+	v, ok := d[key].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: field %s is missing or not a string", errMalformedNode, key)
+	}
+	return v, nil
+}
+
+// nodeInfoFromData converts the data of a node entry in vault to a NodeInfo
+func nodeInfoFromData(d map[string]interface{}) (model.NodeInfo, error) {
+	res := model.NodeInfo{}
+
+	nodeID, err := requiredString(d, "nodeID")
+	if err != nil {
+		return res, err
+	}
+	wgip, err := requiredString(d, "wgip")
+	if err != nil {
+		return res, err
+	}
+	pubkey, err := requiredString(d, "pubkey")
 	if err != nil {
 		return res, err
 	}
+	endpointIP, err := requiredString(d, "endpointIP")
+	if err != nil {
+		return res, err
+	}
+
+	lp := 0
+	switch v := d["endpointPort"].(type) {
+	case json.Number:
+		lp0, err := v.Int64()
+		if err != nil {
+			return res, err
+		}
+		lp = int(lp0)
+	case string:
+		lp, err = strconv.Atoi(v)
+		if err != nil {
+			return res, err
+		}
+	default:
+		return res, fmt.Errorf("%w: unsupported type %T of endpointPort", errMalformedNode, v)
+	}
+
+	// optional, not present for ipv4-only meshes
+	wgip6, _ := d["wgip6"].(string)
+
+	// optional, not present for nodes that never sent a heartbeat
+	var lastSeen time.Time
+	if ls, ok := d["lastSeen"].(string); ok && ls != "" {
+		var err error
+		lastSeen, err = time.Parse(time.RFC3339, ls)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	// optional, not present for unsigned entries
+	signature, _ := d["signature"].(string)
+
+	// optional, only present for nodes which rotated their key
+	nextPubkey, _ := d["nextPubkey"].(string)
+	var keyAcks []string
+	if ka, ok := d["keyAcks"].(string); ok && ka != "" {
+		keyAcks = strings.Split(ka, ",")
+	}
+	var keyActivation time.Time
+	if ka, ok := d["keyActivation"].(string); ok && ka != "" {
+		var err error
+		keyActivation, err = time.Parse(time.RFC3339, ka)
+		if err != nil {
+			return res, err
+		}
+	}
+	var keyDeadline time.Time
+	if kd, ok := d["keyDeadline"].(string); ok && kd != "" {
+		var err error
+		keyDeadline, err = time.Parse(time.RFC3339, kd)
+		if err != nil {
+			return res, err
+		}
+	}
+
 	res = model.NodeInfo{
-		NodeID:             d["nodeID"].(string),
-		WireguardIP:        d["wgip"].(string),
-		WireguardPublicKey: d["pubkey"].(string),
-		ExternalIP:         d["endpointIP"].(string),
-		ListenPort:         int(lp),
+		NodeID:             nodeID,
+		WireguardIP:        wgip,
+		WireguardIP6:       wgip6,
+		WireguardPublicKey: pubkey,
+		ExternalIP:         endpointIP,
+		ListenPort:         lp,
+		LastSeen:           lastSeen,
+		Signature:          signature,
+		NextPublicKey:      nextPubkey,
+		KeyActivation:      keyActivation,
+		KeyDeadline:        keyDeadline,
+		KeyAcks:            keyAcks,
 	}
 
 	return res, nil
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNodeInfoFromData(t *testing.T) {
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"nodeID":       "node1",
+			"wgip":         "10.0.0.1",
+			"pubkey":       "pubkey1",
+			"endpointIP":   "192.168.0.1",
+			"endpointPort": json.Number("54540"),
+			"lastSeen":     "2020-05-01T12:00:00Z",
+		}
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(map[string]interface{})
+		wantErr   error
+		wantPort  int
+		wantError bool
+	}{
+		{"valid", func(d map[string]interface{}) {}, nil, 54540, false},
+		{"port as string", func(d map[string]interface{}) { d["endpointPort"] = "54541" }, nil, 54541, false},
+		{"pubkey as number", func(d map[string]interface{}) { d["pubkey"] = json.Number("1") }, errMalformedNode, 0, true},
+		{"missing node id", func(d map[string]interface{}) { delete(d, "nodeID") }, errMalformedNode, 0, true},
+		{"wgip as bool", func(d map[string]interface{}) { d["wgip"] = true }, errMalformedNode, 0, true},
+		{"missing endpoint ip", func(d map[string]interface{}) { delete(d, "endpointIP") }, errMalformedNode, 0, true},
+		{"port as bool", func(d map[string]interface{}) { d["endpointPort"] = true }, errMalformedNode, 0, true},
+		{"missing port", func(d map[string]interface{}) { delete(d, "endpointPort") }, errMalformedNode, 0, true},
+		{"invalid port", func(d map[string]interface{}) { d["endpointPort"] = "x" }, nil, 0, true},
+		{"invalid last seen", func(d map[string]interface{}) { d["lastSeen"] = "yesterday" }, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := valid()
+			tt.modify(d)
+
+			ni, err := nodeInfoFromData(d)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ni.ListenPort != tt.wantPort {
+				t.Errorf("got port %d, want %d", ni.ListenPort, tt.wantPort)
+			}
+		})
+	}
+}
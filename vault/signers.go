@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// signerPath returns the subkey under which the signing key of nodeID is stored
+func signerPath(nodeID string) string {
+	return fmt.Sprintf("signers/%s", nodeID)
+}
+
+// RegisterSigner stores the public signing key of nodeID using a check-and-set
+// write, so that it cannot be replaced. Returns true if publicKey is registered
+// for nodeID (either by this call or before), false if another key is registered.
+func (vc *Context) RegisterSigner(meshName string, nodeID string, publicKey string) (bool, error) {
+	// read first, nodes may only be allowed to create their key
+	d, err := vc.kvRead(meshName, signerPath(nodeID))
+	if err != nil {
+		return false, err
+	}
+	if d == nil {
+		err = vc.kvCreate(meshName, signerPath(nodeID), map[string]interface{}{
+			"publicKey": publicKey,
+		})
+		if err == nil {
+			log.WithField("id", nodeID).Debug("Registered signer")
+			return true, nil
+		}
+		if err != errKeyExists {
+			return false, err
+		}
+		if d, err = vc.kvRead(meshName, signerPath(nodeID)); err != nil || d == nil {
+			return false, err
+		}
+	}
+
+	registered, _ := d["publicKey"].(string)
+	log.WithFields(log.Fields{"id": nodeID, "publicKey": registered}).Trace("signer already registered")
+
+	return registered == publicKey, nil
+}
+
+// ReadSigners reads the public signing keys of all nodes of a mesh
+func (vc *Context) ReadSigners(meshName string) (map[string]string, error) {
+	keys, err := vc.kvList(meshName, "signers")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		d, err := vc.kvRead(meshName, signerPath(key))
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			continue
+		}
+		if publicKey, ok := d["publicKey"].(string); ok {
+			res[key] = publicKey
+		}
+	}
+	return res, nil
+}
+
+// DeleteSigner deletes the public signing key of nodeID
+func (vc *Context) DeleteSigner(meshName string, nodeID string) error {
+	return vc.kvDelete(meshName, signerPath(nodeID))
+}
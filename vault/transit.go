@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransitKeyName returns the default name of the transit key used
+// to encrypt the node records of meshName
+func TransitKeyName(meshName string) string {
+	return fmt.Sprintf("wgvam-%s", meshName)
+}
+
+// transitPath constructs a vault path into the transit secrets engine
+func transitPath(p string) string {
+	return fmt.Sprintf("%s/%s", strings.Trim(config.Config().VaultTransitPath, "/"), p)
+}
+
+// createTransitKey creates the transit key named key, if not present yet
+func (vc *Context) createTransitKey(meshName, key string) error {
+	_, err := vc.logical(meshName).Write(transitPath(fmt.Sprintf("keys/%s", key)), map[string]interface{}{
+		"type": "aes256-gcm96",
+	})
+	return err
+}
+
+// transitKey returns the name of the transit key node records of meshName are
+// encrypted with, or an empty string if they're stored in plaintext
+func (vc *Context) transitKey(meshName string) (string, error) {
+	vc.lock.RLock()
+	key, ok := vc.meshTransitKeys[meshName]
+	vc.lock.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	mi, err := vc.ReadMeetingPoint(meshName)
+	if err != nil {
+		return "", err
+	}
+	if mi == nil {
+		return "", fmt.Errorf("no meeting point for mesh %s", meshName)
+	}
+
+	vc.lock.Lock()
+	vc.meshTransitKeys[meshName] = mi.TransitKey
+	vc.lock.Unlock()
+
+	return mi.TransitKey, nil
+}
+
+// encryptNodeData encrypts the data of a node record using the
+// transit key of meshName, if the mesh has one
+func (vc *Context) encryptNodeData(meshName string, d map[string]interface{}) (map[string]interface{}, error) {
+	key, err := vc.transitKey(meshName)
+	if err != nil || key == "" {
+		return d, err
+	}
+
+	plaintext, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	s, err := vc.logical(meshName).Write(transitPath(fmt.Sprintf("encrypt/%s", key)), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.Data["ciphertext"] == nil {
+		return nil, errors.New("vault did not return a ciphertext")
+	}
+
+	return map[string]interface{}{
+		"transitKey": key,
+		"ciphertext": s.Data["ciphertext"],
+	}, nil
+}
+
+// decryptNodeData decrypts the data of a node record if it is encrypted,
+// otherwise it is returned as is
+func (vc *Context) decryptNodeData(meshName string, d map[string]interface{}) (map[string]interface{}, error) {
+	ciphertext, ok := d["ciphertext"].(string)
+	if !ok {
+		return d, nil
+	}
+	key, _ := d["transitKey"].(string)
+	if key == "" {
+		return nil, errors.New("encrypted node record without transit key")
+	}
+
+	s, err := vc.logical(meshName).Write(transitPath(fmt.Sprintf("decrypt/%s", key)), map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.Data["plaintext"] == nil {
+		return nil, errors.New("vault did not return a plaintext")
+	}
+	encoded, ok := s.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("vault returned a plaintext which is not a string")
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]interface{})
+	dec := json.NewDecoder(strings.NewReader(string(plaintext)))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	log.WithField("d", res).Trace("decryptNodeData.dump")
+
+	return res, nil
+}
@@ -2,30 +2,54 @@ package vault
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/config"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
 	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
 )
 
 // Context contains links on how to connect to vault
-// and keeps the api client reference
+// and keeps the api client reference. It implements
+// registry.Registry using a KV version 1 or 2 secrets engine.
 type Context struct {
 	client *api.Client
+	// kvVersion is the configured version of the secrets engine,
+	// 0 if it is detected per namespace
+	kvVersion int
+
+	// clients for meshes with a namespace other than the default one
+	lock           sync.RWMutex
+	meshClients    map[string]*api.Client
+	meshNamespaces map[string]string
+	// detected versions of the secrets engine by namespace
+	kvVersions map[string]int
+
+	// transit keys of meshes, read from their meeting points
+	meshTransitKeys map[string]string
 }
 
-// DataPath construct a vault path into the data structure for a given mesh and subkey
+var _ registry.Registry = &Context{}
+
+// DataPath construct a vault path into the data structure for a given mesh and subkey (KV version 2)
 func DataPath(meshName, p string) string {
 	return fmt.Sprintf("%s/data/%s/%s", config.Config().VaultEnginePath, meshName, p)
 }
 
-// MetaDataPath construct a vault path into the meta data structure for a given mesh and subkey
+// MetaDataPath construct a vault path into the meta data structure for a given mesh and subkey (KV version 2)
 func MetaDataPath(meshName, p string) string {
 	return fmt.Sprintf("%s/metadata/%s/%s", config.Config().VaultEnginePath, meshName, p)
 }
 
-// Vault returns a Context struct with a token
-func Vault() *Context {
+// MetaDataRootPath construct a vault path to the root of the meta data structure, where all meshes are listed (KV version 2)
+func MetaDataRootPath() string {
+	return fmt.Sprintf("%s/metadata/", config.Config().VaultEnginePath)
+}
+
+// newClient creates a vault api client from the configuration, without a token
+func newClient() (*api.Client, error) {
 	c := config.Config()
 
 	cfg := api.DefaultConfig()
@@ -34,21 +58,79 @@ func Vault() *Context {
 	cfg.Address = c.VaultAddr
 	cfg.HttpClient.Timeout = 10 * time.Second
 
+	if c.VaultCACert != "" || c.VaultClientCert != "" || c.VaultClientKey != "" || c.VaultTLSServerName != "" {
+		if err := cfg.ConfigureTLS(&api.TLSConfig{
+			CACert:        c.VaultCACert,
+			ClientCert:    c.VaultClientCert,
+			ClientKey:     c.VaultClientKey,
+			TLSServerName: c.VaultTLSServerName,
+		}); err != nil {
+			log.WithError(err).Error("Unable to configure TLS for vault")
+			return nil, err
+		}
+	}
+
 	client, err := api.NewClient(cfg)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	//	log.WithField("client", client).Trace("vault client")
-	if c.VaultToken != "" {
-		client.SetToken(c.VaultToken)
-	} else {
-		client.ClearToken()
+	if c.VaultNamespace != "" {
+		client.SetNamespace(c.VaultNamespace)
 	}
 
-	return &Context{
-		client: client,
+	return client, nil
+}
+
+// Vault returns a Context struct with a token
+func Vault() *Context {
+	c := config.Config()
+
+	client, err := newClient()
+	if err != nil {
+		return nil
+	}
+
+	vc := &Context{
+		client:          client,
+		meshClients:     make(map[string]*api.Client),
+		meshNamespaces:  make(map[string]string),
+		kvVersions:      make(map[string]int),
+		meshTransitKeys: make(map[string]string),
+	}
+
+	meshNamespaces, err := parseMeshNamespaces(c.VaultMeshNamespaces)
+	if err != nil {
+		log.WithError(err).Error("Unable to parse mesh namespaces (env: WGVAM_VAULT_MESH_NAMESPACES)")
+		return nil
+	}
+	for meshName, namespace := range meshNamespaces {
+		if err := vc.PinNamespace(meshName, namespace); err != nil {
+			log.WithError(err).Error("Unable to create vault client for namespace")
+			return nil
+		}
+	}
+
+	if err := vc.authenticate(); err != nil {
+		log.WithError(err).Error("Unable to authenticate against vault")
+		return nil
+	}
+
+	switch c.VaultKVVersion {
+	case 0:
+		// detected on first access of each namespace
+	case 1:
+		vc.kvVersion = c.VaultKVVersion
+		warnKVVersion1()
+	case 2:
+		vc.kvVersion = c.VaultKVVersion
+	default:
+		log.Errorf("Unsupported kv version %d (env: WGVAM_VAULT_KV_VERSION)", c.VaultKVVersion)
+		return nil
 	}
+	log.WithField("version", vc.kvVersion).Trace("kv secrets engine")
 
+	return vc
 }
 
 // Logical returns vaults' api.Logical struct
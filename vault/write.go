@@ -2,54 +2,67 @@ package vault
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aschmidt75/wireguard-vault-automesh/model"
-	log "github.com/sirupsen/logrus"
+	"github.com/aschmidt75/wireguard-vault-automesh/registry"
 )
 
-// WriteNodeData writes the nodeInfo to the nodelist of meshName
-func (vc *Context) WriteNodeData(meshName string, nodeInfo model.NodeInfo) error {
-	data := map[string]interface{}{
-		"data": map[string]interface{}{
-			"nodeID":       nodeInfo.NodeID,
-			"wgip":         nodeInfo.WireguardIP,
-			"pubkey":       nodeInfo.WireguardPublicKey,
-			"endpointIP":   nodeInfo.ExternalIP,
-			"endpointPort": nodeInfo.ListenPort,
-		},
-	}
-	log.WithFields(log.Fields{
-		"data": data,
-	}).Trace("writing to vault")
-	_, err := vc.Logical().Write(DataPath(meshName, fmt.Sprintf("nodes/%s", nodeInfo.NodeID)), data)
-	return err
+var _ registry.NodeVersions = &Context{}
+
+// nodeInfoToData converts a NodeInfo to the data of a node entry in vault
+func nodeInfoToData(nodeInfo model.NodeInfo) map[string]interface{} {
+	d := map[string]interface{}{
+		"nodeID":       nodeInfo.NodeID,
+		"wgip":         nodeInfo.WireguardIP,
+		"pubkey":       nodeInfo.WireguardPublicKey,
+		"endpointIP":   nodeInfo.ExternalIP,
+		"endpointPort": nodeInfo.ListenPort,
+	}
+	if nodeInfo.WireguardIP6 != "" {
+		d["wgip6"] = nodeInfo.WireguardIP6
+	}
+	if !nodeInfo.LastSeen.IsZero() {
+		d["lastSeen"] = nodeInfo.LastSeen.UTC().Format(time.RFC3339)
+	}
+	if nodeInfo.Signature != "" {
+		d["signature"] = nodeInfo.Signature
+	}
+	if nodeInfo.NextPublicKey != "" {
+		d["nextPubkey"] = nodeInfo.NextPublicKey
+	}
+	if !nodeInfo.KeyActivation.IsZero() {
+		d["keyActivation"] = nodeInfo.KeyActivation.UTC().Format(time.RFC3339)
+	}
+	if !nodeInfo.KeyDeadline.IsZero() {
+		d["keyDeadline"] = nodeInfo.KeyDeadline.UTC().Format(time.RFC3339)
+	}
+	if len(nodeInfo.KeyAcks) > 0 {
+		d["keyAcks"] = strings.Join(nodeInfo.KeyAcks, ",")
+	}
+	return d
 }
 
-// UpdateEndpoint updates the fields id, ip, listenport for a given node in a mesh
-func (vc *Context) UpdateEndpoint(meshName string, nodeIDKey string, endpointIP string, listenPort int) error {
-	nodeInfo, err := vc.ReadNode(meshName, nodeIDKey)
+// WriteNodeData writes the nodeInfo to the nodelist of meshName
+func (vc *Context) WriteNodeData(meshName string, nodeInfo model.NodeInfo) error {
+	data, err := vc.encryptNodeData(meshName, nodeInfoToData(nodeInfo))
 	if err != nil {
 		return err
 	}
+	return vc.kvWrite(meshName, fmt.Sprintf("nodes/%s", nodeInfo.NodeID), data)
+}
 
-	data := map[string]interface{}{
-		"data": map[string]interface{}{
-			"nodeID":       nodeInfo.NodeID,
-			"wgip":         nodeInfo.WireguardIP,
-			"pubkey":       nodeInfo.WireguardPublicKey,
-			"endpointIP":   endpointIP,
-			"endpointPort": listenPort,
-		},
-		"metadata": map[string]interface{}{},
-	}
-	log.WithFields(log.Fields{
-		"data": data,
-	}).Trace("writing to vault")
-	_, err = vc.Logical().Write(DataPath(meshName, fmt.Sprintf("nodes/%s", nodeIDKey)), data)
+// WriteNodeDataCAS writes the nodeInfo to the nodelist of meshName if its
+// entry still has version. Returns false if it has been changed in the meantime.
+func (vc *Context) WriteNodeDataCAS(meshName string, nodeInfo model.NodeInfo, version int) (bool, error) {
+	data, err := vc.encryptNodeData(meshName, nodeInfoToData(nodeInfo))
 	if err != nil {
-		log.WithError(err).Error("Error writing to vault. Please check address and token")
-		return err
+		return false, err
 	}
-
-	return nil
+	err = vc.kvWriteCAS(meshName, fmt.Sprintf("nodes/%s", nodeInfo.NodeID), data, version)
+	if err == errKeyExists {
+		return false, nil
+	}
+	return err == nil, err
 }
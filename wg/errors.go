@@ -0,0 +1,33 @@
+package wg
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoSuchInterface is returned if the wireguard interface is not present
+	ErrNoSuchInterface = errors.New("no such interface")
+	// ErrNotWireguard is returned if an interface with the name of the
+	// wireguard interface exists, but is of another type
+	ErrNotWireguard = errors.New("interface is not a wireguard interface")
+	// ErrNoKernelModule is returned if the kernel does not support
+	// wireguard interfaces
+	ErrNoKernelModule = errors.New("wireguard kernel module not available")
+)
+
+// LinkError records a failed netlink operation on an interface
+type LinkError struct {
+	Op        string
+	Interface string
+	Err       error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("%s on %s: %s", e.Op, e.Interface, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
@@ -6,10 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
 	wg "golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -19,9 +24,16 @@ import (
 type WireguardInterface struct {
 	InterfaceName string
 	IP            net.IP // local ip of wg interface
+	IP6           net.IP // local ipv6 of wg interface in dual-stack meshes
 	EndpointIP    net.IP
 	ListenPort    int
 	PublicKey     string
+	// Implementation selects how the interface is created: ImplKernel,
+	// ImplUserspace or ImplAuto (kernel, falling back to userspace).
+	// Defaults to ImplKernel.
+	Implementation string
+	// UserspaceBinary is the path of the wireguard-go binary
+	UserspaceBinary string
 }
 
 // HasInterface checks if the interface is already present
@@ -40,159 +52,248 @@ func (wgi *WireguardInterface) HasInterface() (bool, error) {
 	return (device != nil), nil
 }
 
-// AddInterface adds a new wireguard interface
+// link returns the netlink handle of the wireguard interface, or
+// ErrNoSuchInterface if it is not present
+func (wgi *WireguardInterface) link() (netlink.Link, error) {
+	link, err := linkByName(wgi.InterfaceName)
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		return nil, &LinkError{Op: "find link", Interface: wgi.InterfaceName, Err: ErrNoSuchInterface}
+	}
+	if err != nil {
+		return nil, &LinkError{Op: "find link", Interface: wgi.InterfaceName, Err: err}
+	}
+	if !isWireguardLink(link) {
+		return nil, &LinkError{Op: "find link", Interface: wgi.InterfaceName, Err: ErrNotWireguard}
+	}
+	return link, nil
+}
+
+// isWireguardLink checks if link is a kernel wireguard interface, or the
+// TUN device of wireguard-go. netlink has no type for wireguard links,
+// they are returned as generic links.
+func isWireguardLink(link netlink.Link) bool {
+	switch l := link.(type) {
+	case *netlink.Tuntap:
+		return true
+	case *netlink.GenericLink:
+		return l.LinkType == wireguardLinkType
+	}
+	return false
+}
+
+// AddInterface adds a new wireguard interface, if not present yet
 func (wgi *WireguardInterface) AddInterface() error {
-	i, err := net.InterfaceByName(wgi.InterfaceName)
-
-	if i == nil || err != nil {
-		// create wireguard interface
-		cmd := exec.Command("/sbin/ip", "link", "add", "dev", wgi.InterfaceName, "type", "wireguard")
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-		err := cmd.Run()
+	_, err := wgi.link()
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrNoSuchInterface) {
+		return err
+	}
+
+	switch wgi.Implementation {
+	case "", ImplKernel:
+		err = wgi.addKernelInterface()
+	case ImplUserspace:
+		err = wgi.addUserspaceInterface()
+	case ImplAuto:
+		err = wgi.addKernelInterface()
 		if err != nil {
-			return err
-		}
-		_, errStr := string(stdout.Bytes()), string(stderr.Bytes())
-		if len(errStr) > 0 {
-			e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-			return errors.New(e)
+			log.WithError(err).Warn("Unable to create kernel wireguard interface, falling back to userspace")
+			err = wgi.addUserspaceInterface()
 		}
+	default:
+		err = fmt.Errorf("unknown wireguard implementation: %s", wgi.Implementation)
 	}
-
-	i, err = net.InterfaceByName(wgi.InterfaceName)
 	if err != nil {
 		return err
 	}
-	log.Tracef("created interface %s", i.Name)
+
+	if _, err = wgi.link(); err != nil {
+		return err
+	}
+	log.Tracef("created interface %s", wgi.InterfaceName)
 
 	return nil
 }
 
-// EnsureIPAddressIsAssigned checks the local ip of the associated wireguard
-// interface. if no ip has been assigned yet, the one from WireguardInterface is assigned.
-func (wgi *WireguardInterface) EnsureIPAddressIsAssigned() error {
+// addKernelInterface creates the interface using the kernel module
+func (wgi *WireguardInterface) addKernelInterface() error {
+	la := netlink.NewLinkAttrs()
+	la.Name = wgi.InterfaceName
+	err := netlink.LinkAdd(&netlink.GenericLink{
+		LinkAttrs: la,
+		LinkType:  wireguardLinkType,
+	})
+	if errors.Is(err, syscall.EOPNOTSUPP) {
+		return &LinkError{Op: "add link", Interface: wgi.InterfaceName, Err: ErrNoKernelModule}
+	}
+	if err != nil && !errors.Is(err, syscall.EEXIST) {
+		return &LinkError{Op: "add link", Interface: wgi.InterfaceName, Err: err}
+	}
+	return nil
+}
 
-	var err error
+// addUserspaceInterface starts wireguard-go, which creates a TUN device
+// and a UAPI socket for wgctrl, and waits for the device to show up
+func (wgi *WireguardInterface) addUserspaceInterface() error {
+	binary := wgi.UserspaceBinary
+	if binary == "" {
+		binary = defaultUserspaceBinary
+	}
 
-	i, err := net.InterfaceByName(wgi.InterfaceName)
+	// wireguard-go daemonizes itself. Newer versions refuse to run
+	// when the kernel module is available, unless told otherwise.
+	cmd := exec.Command(binary, wgi.InterfaceName)
+	cmd.Env = append(os.Environ(), "WG_I_PREFER_BUGGY_USERSPACE_TO_POLISHED_KMOD=1")
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return err
+		return &LinkError{Op: "start " + binary, Interface: wgi.InterfaceName, Err: fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))}
 	}
-	log.WithField("intfName", i.Name).Tracef("found wg interface")
 
-	// Assign IP if not yet present
-	a, err := i.Addrs()
+	for i := 0; i < userspaceStartupChecks; i++ {
+		if ex, err := wgi.HasInterface(); err == nil && ex {
+			log.WithField("intf", wgi.InterfaceName).Debug("Started userspace wireguard")
+			return nil
+		}
+		time.Sleep(userspaceStartupInterval)
+	}
+	return &LinkError{Op: "start " + binary, Interface: wgi.InterfaceName, Err: errors.New("device did not show up")}
+}
+
+// EnsureIPAddressIsAssigned checks the local ips of the associated wireguard
+// interface. if IP or IP6 from WireguardInterface have not been assigned yet,
+// they are added as host addresses (/32 resp. /128).
+func (wgi *WireguardInterface) EnsureIPAddressIsAssigned() error {
+	link, err := wgi.link()
 	if err != nil {
 		return err
 	}
-	if len(a) == 0 {
-		cmd := exec.Command("/sbin/ip", "address", "add", "dev", wgi.InterfaceName, wgi.IP.String())
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-		err := cmd.Run()
+	log.WithField("intfName", wgi.InterfaceName).Tracef("found wg interface")
+
+	for _, ip := range []net.IP{wgi.IP, wgi.IP6} {
+		if ip == nil {
+			continue
+		}
+
+		// Assign IP if not yet present
+		bAssigned, err := hasAddr(link, ip)
 		if err != nil {
-			return err
+			return &LinkError{Op: "list addresses", Interface: wgi.InterfaceName, Err: err}
 		}
-		_, errStr := string(stdout.Bytes()), string(stderr.Bytes())
-		if len(errStr) > 0 {
-			e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-			return errors.New(e)
+		if bAssigned {
+			continue
 		}
-	}
 
-	a, err = i.Addrs()
-	if len(a) == 0 {
-		e := fmt.Sprintf("unable to add ip address %s to interface %s: %s", wgi.IP.String(), wgi.InterfaceName, err)
-		return errors.New(e)
+		err = netlink.AddrAdd(link, &netlink.Addr{IPNet: hostNet(ip)})
+		if err != nil && !errors.Is(err, syscall.EEXIST) {
+			return &LinkError{Op: fmt.Sprintf("add address %s", ip), Interface: wgi.InterfaceName, Err: err}
+		}
+		log.WithFields(log.Fields{
+			"intfName": wgi.InterfaceName,
+			"ip":       ip,
+		}).Tracef("added ip to interface")
 	}
-	log.WithFields(log.Fields{
-		"intfName": i.Name,
-		"ip":       a[0],
-	}).Tracef("added ip to interface")
 
 	return nil
 }
 
-// EnsureInterfaceIsUp checks if the wireguard interface is up. if not, up's it. all using /sbin/ip
-func (wgi *WireguardInterface) EnsureInterfaceIsUp() error {
-
-	// bring up wireguard interface
-	cmd := exec.Command("/sbin/ip", "--br", "link", "show", "dev", wgi.InterfaceName, "up", "type", "wireguard")
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+// hasAddr checks if ip is assigned to link
+func hasAddr(link netlink.Link, ip net.IP) (bool, error) {
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	addrs, err := netlink.AddrList(link, family)
 	if err != nil {
-		return err
+		return false, err
 	}
-	outStr, errStr := string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+	for _, addr := range addrs {
+		if addr.IP.Equal(ip) {
+			return true, nil
+		}
 	}
-	if len(outStr) > 0 {
-		// output should contain interface name an "UP" TODO
-		log.WithField("o", outStr).Trace("Interface is up")
-		return nil
+	return false, nil
+}
+
+// hostNet returns a host network (/32 for ipv4, /128 for ipv6) for given ip
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
 	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
 
-	// bring up wireguard interface
-	cmd = exec.Command("/sbin/ip", "link", "set", "up", "dev", wgi.InterfaceName)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+// HostNets returns host networks (/32 for ipv4, /128 for ipv6) for
+// all given ips, e.g. to be used as a peer's allowed ips.
+func HostNets(ips []string) []net.IPNet {
+	res := make([]net.IPNet, 0, len(ips))
+	for _, ipStr := range ips {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			continue
+		}
+		res = append(res, *hostNet(ip))
+	}
+	return res
+}
+
+// EnsureInterfaceIsUp checks if the wireguard interface is up. if not, up's it.
+func (wgi *WireguardInterface) EnsureInterfaceIsUp() error {
+	link, err := wgi.link()
 	if err != nil {
 		return err
 	}
-	_, errStr = string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+	if link.Attrs().Flags&net.FlagUp != 0 {
+		log.WithField("intf", wgi.InterfaceName).Trace("Interface is up")
+		return nil
+	}
+
+	// bring up wireguard interface
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &LinkError{Op: "set link up", Interface: wgi.InterfaceName, Err: err}
 	}
 
 	return nil
 }
 
-// EnsureRouteIsSet checks if there is a route to given network. If not, adds it. all using /sbin/ip
+// EnsureRouteIsSet checks if there is a route to given network via the
+// wireguard interface. If not, adds it.
 func (wgi *WireguardInterface) EnsureRouteIsSet(networkCIDR string) error {
+	_, ipnet, err := net.ParseCIDR(networkCIDR)
+	if err != nil {
+		return err
+	}
+	family := netlink.FAMILY_V4
+	if ipnet.IP.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
 
-	//
-	cmd := exec.Command("/sbin/ip", "route", "show", "dev", wgi.InterfaceName)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	link, err := wgi.link()
 	if err != nil {
 		return err
 	}
-	outStr, errStr := string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+
+	routes, err := netlink.RouteListFiltered(family, &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+	}, netlink.RT_FILTER_OIF)
+	if err != nil {
+		return &LinkError{Op: "list routes", Interface: wgi.InterfaceName, Err: err}
 	}
-	a := strings.Split(outStr, " ")
-	if len(a) > 0 {
-		if a[0] == networkCIDR {
-			log.WithField("o", outStr).Trace("Route present")
+	for _, route := range routes {
+		if route.Dst != nil && route.Dst.String() == ipnet.String() {
+			log.WithField("route", route).Trace("Route present")
 			return nil
 		}
 	}
 
-	//
-	cmd = exec.Command("/sbin/ip", "route", "add", networkCIDR, "dev", wgi.InterfaceName)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	_, errStr = string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+	err = netlink.RouteAdd(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       ipnet,
+		Scope:     netlink.SCOPE_LINK,
+	})
+	if err != nil && !errors.Is(err, syscall.EEXIST) {
+		return &LinkError{Op: fmt.Sprintf("add route %s", ipnet), Interface: wgi.InterfaceName, Err: err}
 	}
 
 	return nil
@@ -268,7 +369,83 @@ func (wgi *WireguardInterface) SetupInterfaceWithConfig() error {
 	return nil
 }
 
-// AddPeer adds a new peer to an existing interface
+// GenerateKeyPair returns a new private key and its public key
+func GenerateKeyPair() (string, string, error) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return "", "", err
+	}
+	return key.String(), key.PublicKey().String(), nil
+}
+
+// PublicKey returns the public key of given private key
+func PublicKey(privateKey string) (string, error) {
+	key, err := wgtypes.ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return key.PublicKey().String(), nil
+}
+
+// PrivateKey reads the private key of the interface. Returns "" if
+// the interface has no key yet.
+func (wgi *WireguardInterface) PrivateKey() (string, error) {
+	wgClient, err := wg.New()
+	if err != nil {
+		return "", err
+	}
+	defer wgClient.Close()
+
+	wgDevice, err := wgClient.Device(wgi.InterfaceName)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Compare(wgDevice.PrivateKey[:], emptyBytes32) == 0 {
+		return "", nil
+	}
+	return wgDevice.PrivateKey.String(), nil
+}
+
+// SetPrivateKey sets the private key of the interface and updates
+// wgi.PublicKey. Peers keep their configuration, but existing sessions
+// are dropped, so peers must know the new public key to connect again.
+func (wgi *WireguardInterface) SetPrivateKey(privateKey string) error {
+	key, err := wgtypes.ParseKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	wgClient, err := wg.New()
+	if err != nil {
+		return err
+	}
+	defer wgClient.Close()
+
+	err = wgClient.ConfigureDevice(wgi.InterfaceName, wgtypes.Config{
+		PrivateKey: &key,
+	})
+	if err != nil {
+		return err
+	}
+
+	wgi.PublicKey = key.PublicKey().String()
+	log.WithFields(log.Fields{"intf": wgi.InterfaceName, "pubkey": wgi.PublicKey}).Info("Set private key.")
+
+	return nil
+}
+
+// GeneratePresharedKey returns a new random preshared key
+func GeneratePresharedKey() (string, error) {
+	key, err := wgtypes.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	return key.String(), nil
+}
+
+// AddPeer adds a new peer to an existing interface. If the peer is already
+// present, its allowed ips are updated if they have changed, and its
+// preshared key if psk is given and has changed.
 func (wgi *WireguardInterface) AddPeer(remoteEndpointIP string, listenPort int, pubkey string, allowedIPs []net.IPNet, psk *string) (bool, error) {
 	wgClient, err := wg.New()
 	if err != nil {
@@ -285,23 +462,47 @@ func (wgi *WireguardInterface) AddPeer(remoteEndpointIP string, listenPort int,
 	if err != nil {
 		return false, err
 	}
+	var pskAsKey wgtypes.Key
+	if psk != nil {
+		pskAsKey, err = wgtypes.ParseKey(*psk)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	for _, peer := range wgDevice.Peers {
-		if peer.PublicKey == pk {
+		if peer.PublicKey != pk {
+			continue
+		}
+		bSamePSK := psk == nil || peer.PresharedKey == pskAsKey
+		bSameIPs := sameIPNets(peer.AllowedIPs, allowedIPs)
+		if bSamePSK && bSameIPs {
 			log.WithField("pubkey", pubkey).Trace("Already present, skipping")
 			return false, nil
 		}
-	}
 
-	var pskAsKey wgtypes.Key
-	if psk != nil {
-		pskAsKey, err = wgtypes.ParseKey(*psk)
+		// present, but preshared key or allowed ips have changed
+		peerConfig := wgtypes.PeerConfig{
+			PublicKey:         pk,
+			UpdateOnly:        true,
+			ReplaceAllowedIPs: !bSameIPs,
+			AllowedIPs:        allowedIPs,
+		}
+		if !bSamePSK {
+			peerConfig.PresharedKey = &pskAsKey
+		}
+		err = wgClient.ConfigureDevice(wgi.InterfaceName, wgtypes.Config{
+			Peers: []wgtypes.PeerConfig{peerConfig},
+		})
 		if err != nil {
 			return false, err
 		}
+		log.WithFields(log.Fields{"intf": wgi.InterfaceName, "PubKey": pubkey}).Info("Updated peer.")
+		return false, nil
 	}
 
 	// process peer
-	ep, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", remoteEndpointIP, listenPort))
+	ep, err := net.ResolveUDPAddr("udp", net.JoinHostPort(remoteEndpointIP, strconv.Itoa(listenPort)))
 	if err != nil {
 		return false, err
 	}
@@ -329,47 +530,40 @@ func (wgi *WireguardInterface) AddPeer(remoteEndpointIP string, listenPort int,
 	return true, nil
 }
 
+// sameIPNets checks if a and b contain the same networks, in any order
+func sameIPNets(a []net.IPNet, b []net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	nets := make(map[string]bool, len(a))
+	for _, n := range a {
+		nets[n.String()] = true
+	}
+	for _, n := range b {
+		if !nets[n.String()] {
+			return false
+		}
+	}
+	return true
+}
+
 // RemoveWgInterface takes down an existing wireguard interface
 func (wgi *WireguardInterface) RemoveWgInterface() error {
-	i, err := net.InterfaceByName(wgi.InterfaceName)
-
+	link, err := wgi.link()
 	if err != nil {
 		return err
 	}
-	if i == nil {
-		e := fmt.Sprintf("No network/interface by name %s", wgi.InterfaceName)
-		return errors.New(e)
-	}
 
 	// remove all peers (necessary?)
 
 	// take down wireguard interface
-	cmd := exec.Command("/sbin/ip", "link", "set", "down", "dev", wgi.InterfaceName)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	_, errStr := string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+	if err := netlink.LinkSetDown(link); err != nil {
+		return &LinkError{Op: "set link down", Interface: wgi.InterfaceName, Err: err}
 	}
 
 	// remove wireguard interface
-	cmd = exec.Command("/sbin/ip", "link", "delete", "dev", wgi.InterfaceName, "type", "wireguard")
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	_, errStr = string(stdout.Bytes()), string(stderr.Bytes())
-	if len(errStr) > 0 {
-		e := fmt.Sprintf("/sbin/ip reported: %s", errStr)
-		return errors.New(e)
+	if err := netlink.LinkDel(link); err != nil {
+		return &LinkError{Op: "delete link", Interface: wgi.InterfaceName, Err: err}
 	}
 
 	log.WithFields(log.Fields{"intf": wgi.InterfaceName}).Info("Removed wireguard interface")
@@ -458,6 +652,69 @@ func (wgi *WireguardInterface) IterateWgPeers(cb IterateWgPeerFunc) error {
 	return nil
 }
 
+// PeerInfo contains the runtime data of a single wireguard peer
+type PeerInfo struct {
+	PublicKey     string    `json:"pubkey"`
+	Endpoint      string    `json:"endpoint"`
+	AllowedIPs    []string  `json:"allowedIPs"`
+	LastHandshake time.Time `json:"lastHandshake"`
+	ReceiveBytes  int64     `json:"rxBytes"`
+	TransmitBytes int64     `json:"txBytes"`
+}
+
+// Peers reads all peers of the wireguard device including their
+// handshake and transfer data
+func (wgi *WireguardInterface) Peers() ([]PeerInfo, error) {
+	wgClient, err := wg.New()
+	if err != nil {
+		return nil, err
+	}
+	defer wgClient.Close()
+
+	wgDevice, err := wgClient.Device(wgi.InterfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]PeerInfo, 0, len(wgDevice.Peers))
+	for _, peer := range wgDevice.Peers {
+		pi := PeerInfo{
+			PublicKey:     base64.StdEncoding.EncodeToString(peer.PublicKey[:]),
+			AllowedIPs:    make([]string, 0, len(peer.AllowedIPs)),
+			LastHandshake: peer.LastHandshakeTime,
+			ReceiveBytes:  peer.ReceiveBytes,
+			TransmitBytes: peer.TransmitBytes,
+		}
+		if peer.Endpoint != nil {
+			pi.Endpoint = peer.Endpoint.String()
+		}
+		for _, allowedIP := range peer.AllowedIPs {
+			pi.AllowedIPs = append(pi.AllowedIPs, allowedIP.String())
+		}
+		res = append(res, pi)
+	}
+
+	return res, nil
+}
+
+// Implementations of wireguard interfaces
+const (
+	ImplKernel    = "kernel"
+	ImplUserspace = "userspace"
+	ImplAuto      = "auto"
+)
+
+const (
+	wireguardLinkType = "wireguard"
+
+	defaultUserspaceBinary   = "wireguard-go"
+	userspaceStartupChecks   = 50
+	userspaceStartupInterval = 100 * time.Millisecond
+)
+
 var (
 	emptyBytes32 = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	// linkByName looks up network interfaces, replaceable in tests
+	linkByName = netlink.LinkByName
 )
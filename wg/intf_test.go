@@ -0,0 +1,78 @@
+package wg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestLink(t *testing.T) {
+	la := netlink.NewLinkAttrs()
+	la.Name = "wg-test"
+
+	tests := []struct {
+		name    string
+		link    netlink.Link
+		lookErr error
+		wantErr error
+	}{
+		{"kernel", &netlink.GenericLink{LinkAttrs: la, LinkType: "wireguard"}, nil, nil},
+		{"wireguard-go", &netlink.Tuntap{LinkAttrs: la, Mode: netlink.TUNTAP_MODE_TUN}, nil, nil},
+		{"other generic", &netlink.GenericLink{LinkAttrs: la, LinkType: "vxlan"}, nil, ErrNotWireguard},
+		{"dummy", &netlink.Dummy{LinkAttrs: la}, nil, ErrNotWireguard},
+		{"bridge", &netlink.Bridge{LinkAttrs: la}, nil, ErrNotWireguard},
+		{"missing", nil, netlink.LinkNotFoundError{}, ErrNoSuchInterface},
+	}
+
+	defer func() { linkByName = netlink.LinkByName }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linkByName = func(name string) (netlink.Link, error) {
+				if name != la.Name {
+					t.Fatalf("looked up %s, want %s", name, la.Name)
+				}
+				return tt.link, tt.lookErr
+			}
+
+			wgi := &WireguardInterface{InterfaceName: la.Name}
+			link, err := wgi.link()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("link() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("link() error = %v", err)
+			}
+			if link != tt.link {
+				t.Errorf("link() = %v, want %v", link, tt.link)
+			}
+		})
+	}
+}
+
+func TestSameIPNets(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want bool
+	}{
+		{"both empty", nil, nil, true},
+		{"same", []string{"10.0.0.1", "fd00::1"}, []string{"10.0.0.1", "fd00::1"}, true},
+		{"other order", []string{"10.0.0.1", "fd00::1"}, []string{"fd00::1", "10.0.0.1"}, true},
+		{"staged peer without ips", nil, []string{"10.0.0.1"}, false},
+		{"other ip", []string{"10.0.0.1"}, []string{"10.0.0.2"}, false},
+		{"additional ip", []string{"10.0.0.1"}, []string{"10.0.0.1", "fd00::1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameIPNets(HostNets(tt.a), HostNets(tt.b)); got != tt.want {
+				t.Errorf("sameIPNets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -25,17 +25,27 @@ func main() {
 
 	app.Version("version", version)
 
-	app.Spec = "[-d] [-v]"
+	app.Spec = "[-d] [-v] [-a=<VAULT-ADDR>] [-b=<BACKEND>] [--require-signatures]"
 
 	debug := app.BoolOpt("d debug", c.Debug, "Show debug messages (env: WGVAM_LOG_DEBUG)")
 	verbose := app.BoolOpt("v verbose", c.Verbose, "Show information. Default: true. False equals to being quiet (env: WGVAM_LOG_VERBOSE)")
 	vaultAddrParam := app.StringOpt("a addr", c.VaultAddr, "Set vault endpoint (env: WGVAM_VAULT_ADDR)")
+	backendParam := app.StringOpt("b backend", c.Backend, "Set registry backend: vault (address from --addr), consul://[host:port]/[prefix] or file:///path (env: WGVAM_BACKEND)")
+	requireSignatures := app.BoolOpt("require-signatures", c.RequireSignatures, "Ignore unsigned node entries. Default: accept them with a warning, e.g. while upgrading (env: WGVAM_REQUIRE_SIGNATURES)")
 
 	app.Command("create", "create a wireguard mesh meeting point", cmd.Create)
+	app.Command("list", "list all wireguard mesh meeting points", cmd.List)
+	app.Command("nodes", "list all nodes of a wireguard mesh", cmd.Nodes)
 	app.Command("delete", "delete a wireguard mesh meeting point and all node data", cmd.Delete)
+	app.Command("invite", "create a single-use invite for a node to join a wireguard mesh", cmd.Invite)
+	app.Command("policy", "generate a vault policy for admins, members or readers of a wireguard mesh", cmd.Policy)
 	app.Command("join", "join a wireguard mesh", cmd.Join)
 	app.Command("update", "update peers for a wireguard mesh", cmd.Update)
 	app.Command("leave", "leave a wireguard mesh", cmd.Leave)
+	app.Command("agent", "continuously update peers for a wireguard mesh", cmd.Agent)
+	app.Command("status", "show status of a wireguard mesh and its peers", cmd.Status)
+	app.Command("rotate-key", "rotate the wireguard key of this node in a wireguard mesh", cmd.RotateKey)
+	app.Command("prune", "delete nodes of a wireguard mesh that stopped sending heartbeats", cmd.Prune)
 
 	app.Before = func() {
 		if debug != nil {
@@ -46,10 +56,16 @@ func main() {
 		}
 		logging.InitLogging(c.Trace, c.Debug, c.Verbose)
 
-		log.WithField("cfg", c).Trace("config")
+		log.WithField("cfg", c.Redacted()).Trace("config")
 
+		if requireSignatures != nil {
+			c.RequireSignatures = *requireSignatures
+		}
+		if len(*backendParam) > 0 {
+			c.Backend = *backendParam
+		}
 		// issue warning if we do not have a token. may continue using vault agent.
-		if len(c.VaultToken) == 0 {
+		if cmd.IsVaultBackend() && c.VaultAuth == "token" && len(c.VaultToken) == 0 {
 			log.Warn("No vault token supplied, assuming agent mode. (env: WGVAM_VAULT_TOKEN)")
 		}
 		if len(*vaultAddrParam) > 0 {